@@ -2,15 +2,28 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"math"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
-const baseURL = "https://www.pathofexile.com/api/trade/"
+const DefaultBaseURL = "https://www.pathofexile.com/api/trade/"
+
+// Max number of trade IDs accepted by a single fetch request
+const maxFetchIDs = 20
+
+// Number of times a request is retried after being rate-limited
+const maxRetries = 3
+
+// Rate-limit keys, GGG applies separate policies to each endpoint
+const (
+	exchangeEndpoint = "exchange"
+	fetchEndpoint    = "fetch"
+)
 
 type Trades struct {
 	ID       string   `json:"id"`
@@ -52,42 +65,98 @@ type tradeDetail struct {
 }
 
 type TradeDetail struct {
-	Account     string
-	AFK         bool
-	Whisper     string
-	PriceAmount uint
-	PriceUnit   string
-	ItemAmount  uint
-	ItemUnit    string
-	Stock       uint
-	Ratio       float64
+	// Listing ID, empty for listings recorded by older versions
+	ID          string  `json:"id,omitempty"`
+	Account     string  `json:"account"`
+	AFK         bool    `json:"afk"`
+	Whisper     string  `json:"whisper"`
+	PriceAmount uint    `json:"priceAmount"`
+	PriceUnit   string  `json:"priceUnit"`
+	ItemAmount  uint    `json:"itemAmount"`
+	ItemUnit    string  `json:"itemUnit"`
+	Stock       uint    `json:"stock"`
+	Ratio       float64 `json:"ratio"`
 }
 
+// Exchange is a source of bulk item listings. Client queries the official
+// exchange API but any other source (e.g. fakes, caches) can be substituted.
+type Exchange interface {
+	GetBulkTrades(ctx context.Context, initialItem, targetItem string, minStock uint) (*Trades, error)
+	GetTradeDetails(ctx context.Context, queryID string, tradeIDs []string) (*[]TradeDetail, error)
+}
+
+var _ Exchange = (*Client)(nil)
+
 type Client struct {
-	client http.Client
-	league string
+	client  http.Client
+	baseURL string
+	league  string
+	limiter *rateLimiter
 }
 
-func NewClient(httpClient http.Client, league string) *Client {
+// NewClient creates a client for the exchange API at baseURL, DefaultBaseURL is
+// used if baseURL is empty
+func NewClient(httpClient http.Client, baseURL, league string) *Client {
+	baseURL = strings.TrimSpace(baseURL)
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
 	return &Client{
-		client: httpClient,
-		league: league,
+		client:  httpClient,
+		baseURL: baseURL,
+		league:  league,
+		limiter: newRateLimiter(),
 	}
 }
 
-func (c *Client) GetBulkTrades(initialItem, targetItem string, minStock uint) (*Trades, error) {
-	postStr := getPostParams(initialItem, targetItem, minStock)
-	req, err := http.NewRequest(
-		"POST",
-		baseURL+"exchange/"+c.league,
-		bytes.NewBufferString(postStr),
-	)
-	if err != nil {
-		return nil, err
+// do sends the request built by newRequest once the rate limiter allows it and
+// retries when GGG responds with 429. newRequest is called for every attempt
+// since request bodies cannot be reused.
+func (c *Client) do(ctx context.Context, endpoint string, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.Wait(ctx, endpoint); err != nil {
+			return nil, err
+		}
+
+		req, err := newRequest()
+		if err != nil {
+			c.limiter.Update(endpoint, nil)
+			return nil, err
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			c.limiter.Update(endpoint, nil)
+			return nil, err
+		}
+		c.limiter.Update(endpoint, resp)
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRetries {
+			resp.Body.Close()
+			continue
+		}
+		return resp, nil
 	}
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.client.Do(req)
+func (c *Client) GetBulkTrades(ctx context.Context, initialItem, targetItem string, minStock uint) (*Trades, error) {
+	postStr := getPostParams(initialItem, targetItem, minStock)
+	resp, err := c.do(ctx, exchangeEndpoint, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(
+			ctx,
+			"POST",
+			c.baseURL+"exchange/"+url.PathEscape(c.league),
+			bytes.NewBufferString(postStr),
+		)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -105,28 +174,29 @@ func (c *Client) GetBulkTrades(initialItem, targetItem string, minStock uint) (*
 	return &bulkTrades, nil
 }
 
-func (c *Client) getTradeDetails(queryID string, tradeIDs []string) (*[]tradeDetail, error) {
+func (c *Client) getTradeDetails(ctx context.Context, queryID string, tradeIDs []string) (*[]tradeDetail, error) {
 	var tradeDetails []tradeDetail
 	if len(tradeIDs) == 0 {
 		return &tradeDetails, nil
 	}
-	if len(tradeIDs) > 20 {
-		return nil, errors.New("bulk trade API has a max limit of 20 ids")
+	if len(tradeIDs) > maxFetchIDs {
+		return nil, fmt.Errorf("bulk trade API has a max limit of %d ids", maxFetchIDs)
 	}
 
 	tradeIDsStr := strings.Join(tradeIDs, ",")
-	req, err := http.NewRequest("GET", baseURL+"fetch/"+tradeIDsStr, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	queryParams := req.URL.Query()
-	queryParams.Add("exchange", "")
-	queryParams.Add("query", queryID)
-	req.URL.RawQuery = queryParams.Encode()
+	resp, err := c.do(ctx, fetchEndpoint, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"fetch/"+tradeIDsStr, nil)
+		if err != nil {
+			return nil, err
+		}
 
-	resp, err := c.client.Do(req)
+		req.Header.Set("Content-Type", "application/json")
+		queryParams := req.URL.Query()
+		queryParams.Add("exchange", "")
+		queryParams.Add("query", queryID)
+		req.URL.RawQuery = queryParams.Encode()
+		return req, nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -149,14 +219,24 @@ func (c *Client) getTradeDetails(queryID string, tradeIDs []string) (*[]tradeDet
 	}
 }
 
-func (c *Client) GetTradeDetails(queryID string, tradeIDs []string) (*[]TradeDetail, error) {
-	tradeDetails, err := c.getTradeDetails(queryID, tradeIDs)
-	if err != nil {
-		return nil, err
+// GetTradeDetails fetches the listings of tradeIDs in pages of 20 since the
+// fetch API rejects larger requests
+func (c *Client) GetTradeDetails(ctx context.Context, queryID string, tradeIDs []string) (*[]TradeDetail, error) {
+	tradeDetails := make([]tradeDetail, 0, len(tradeIDs))
+	for start := 0; start < len(tradeIDs); start += maxFetchIDs {
+		end := start + maxFetchIDs
+		if end > len(tradeIDs) {
+			end = len(tradeIDs)
+		}
+		page, err := c.getTradeDetails(ctx, queryID, tradeIDs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		tradeDetails = append(tradeDetails, *page...)
 	}
 
-	formattedTradeDetails := make([]TradeDetail, 0, len(*tradeDetails))
-	for _, tradeDetail := range *tradeDetails {
+	formattedTradeDetails := make([]TradeDetail, 0, len(tradeDetails))
+	for _, tradeDetail := range tradeDetails {
 		cost := tradeDetail.Listing.Price.Exchange.Amount
 		itemAmount := tradeDetail.Listing.Price.Item.Amount
 		// TODO: Rounding up partial amounts will increase trade costs but this
@@ -164,6 +244,7 @@ func (c *Client) GetTradeDetails(queryID string, tradeIDs []string) (*[]TradeDet
 		roundedPriceAmount := uint(math.Ceil(cost))
 		roundedItemAmount := uint(math.Floor(itemAmount))
 		formattedTrade := TradeDetail{
+			ID:          tradeDetail.ID,
 			Account:     tradeDetail.Listing.Account.Name,
 			AFK:         tradeDetail.Listing.Account.Online.Status == "afk",
 			Whisper:     tradeDetail.Listing.Whisper,
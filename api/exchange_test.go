@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGetTradeDetailsPages(t *testing.T) {
+	var mu sync.Mutex
+	pages := make([][]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids := strings.Split(strings.TrimPrefix(r.URL.Path, "/fetch/"), ",")
+		mu.Lock()
+		pages = append(pages, ids)
+		mu.Unlock()
+
+		if r.URL.Query().Get("query") != "query" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		result := make([]map[string]interface{}, 0, len(ids))
+		for _, id := range ids {
+			result = append(result, map[string]interface{}{
+				"id": id,
+				"listing": map[string]interface{}{
+					"account": map[string]interface{}{"name": "seller-" + id},
+					"price": map[string]interface{}{
+						"exchange": map[string]interface{}{"currency": "chaos", "amount": 10},
+						"item":     map[string]interface{}{"currency": "exalted", "amount": 1, "stock": 5},
+					},
+				},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+	}))
+	defer server.Close()
+
+	tradeIDs := make([]string, 0, 45)
+	for i := 0; i < 45; i++ {
+		tradeIDs = append(tradeIDs, fmt.Sprintf("id%02d", i))
+	}
+	client := NewClient(http.Client{}, server.URL, "Standard")
+	tradeDetails, err := client.GetTradeDetails(context.Background(), "query", tradeIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pages) != 3 {
+		t.Fatalf("sent %d fetch requests, want 3", len(pages))
+	}
+	for i, want := range []int{20, 20, 5} {
+		if len(pages[i]) != want {
+			t.Errorf("request %d fetched %d ids, want %d", i, len(pages[i]), want)
+		}
+	}
+
+	if len(*tradeDetails) != len(tradeIDs) {
+		t.Fatalf("GetTradeDetails() returned %d listings, want %d", len(*tradeDetails), len(tradeIDs))
+	}
+	for i, tradeDetail := range *tradeDetails {
+		if tradeDetail.ID != tradeIDs[i] || tradeDetail.Account != "seller-"+tradeIDs[i] {
+			t.Errorf("listing %d = %s from %s, want %s", i, tradeDetail.ID, tradeDetail.Account, tradeIDs[i])
+		}
+		if tradeDetail.PriceAmount != 10 || tradeDetail.ItemAmount != 1 || tradeDetail.Stock != 5 {
+			t.Errorf("listing %d = %+v", i, tradeDetail)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Used when GGG responds with 429 without telling us how long to wait
+const defaultRetryAfter = 10 * time.Second
+
+// rateLimitWindow mirrors a single "hits:period:restriction" entry from the
+// X-Rate-Limit-<Rule> headers. It behaves like a token bucket of maxHits
+// tokens where each token is returned period after it was spent.
+type rateLimitWindow struct {
+	rule        string
+	maxHits     int
+	period      time.Duration
+	restriction time.Duration
+	hits        []time.Time
+}
+
+type rateLimitPolicy struct {
+	name         string
+	windows      []*rateLimitWindow
+	blockedUntil time.Time
+	// Closed once the first response for the policy has been seen. Requests
+	// are serialized until then since the limits are unknown.
+	probing chan struct{}
+	// Set once a response was seen, even without rate-limit headers (e.g. a
+	// local stand-in) so that requests are no longer serialized
+	probed bool
+}
+
+// rateLimiter tracks GGG rate-limit state per endpoint (e.g. exchange, fetch)
+// and delays requests that would exceed any of the advertised windows
+type rateLimiter struct {
+	mu       sync.Mutex
+	policies map[string]*rateLimitPolicy
+	now      func() time.Time
+}
+
+type rateLimitRule struct {
+	hits   int
+	period time.Duration
+	// Restriction in the limit header, active restriction in the state header
+	restriction time.Duration
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		policies: make(map[string]*rateLimitPolicy),
+		now:      time.Now,
+	}
+}
+
+func (l *rateLimiter) policy(key string) *rateLimitPolicy {
+	policy, ok := l.policies[key]
+	if !ok {
+		policy = &rateLimitPolicy{}
+		l.policies[key] = policy
+	}
+	return policy
+}
+
+// Wait blocks until a request for key can be sent without exceeding any
+// known window and reserves a hit in every window. A nil limiter never waits.
+func (l *rateLimiter) Wait(ctx context.Context, key string) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		policy := l.policy(key)
+
+		if probing := policy.probing; probing != nil {
+			l.mu.Unlock()
+			select {
+			case <-probing:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		now := l.now()
+		delay := policy.blockedUntil.Sub(now)
+		for _, window := range policy.windows {
+			window.prune(now)
+			if len(window.hits) >= window.maxHits {
+				oldestHit := window.hits[len(window.hits)-window.maxHits]
+				if windowDelay := oldestHit.Add(window.period).Sub(now); windowDelay > delay {
+					delay = windowDelay
+				}
+			}
+		}
+
+		if delay <= 0 {
+			for _, window := range policy.windows {
+				window.hits = append(window.hits, now)
+			}
+			if !policy.probed && len(policy.windows) == 0 {
+				policy.probing = make(chan struct{})
+			}
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Update syncs the local state with the rate-limit headers of resp. A nil
+// resp (i.e. transport failure) only releases a pending probe.
+func (l *rateLimiter) Update(key string, resp *http.Response) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	policy := l.policy(key)
+	if policy.probing != nil {
+		close(policy.probing)
+		policy.probing = nil
+	}
+	if resp == nil {
+		return
+	}
+
+	now := l.now()
+	header := resp.Header
+	if name := header.Get("X-Rate-Limit-Policy"); name != "" {
+		policy.name = name
+	}
+
+	rules := splitHeader(header.Get("X-Rate-Limit-Rules"))
+	if len(rules) == 0 && header.Get("X-Rate-Limit-Ip") != "" {
+		rules = []string{"Ip"}
+	}
+
+	blocked := false
+	if len(rules) > 0 {
+		windows := make([]*rateLimitWindow, 0, len(policy.windows))
+		for _, rule := range rules {
+			limits := parseRateLimitRules(header.Get("X-Rate-Limit-" + rule))
+			states := parseRateLimitRules(header.Get("X-Rate-Limit-" + rule + "-State"))
+			for _, limit := range limits {
+				window := policy.window(rule, limit.period)
+				if window == nil {
+					window = &rateLimitWindow{rule: rule, period: limit.period}
+				}
+				window.maxHits = limit.hits
+				window.restriction = limit.restriction
+				window.prune(now)
+
+				for _, state := range states {
+					if state.period != limit.period {
+						continue
+					}
+					// Other clients sharing the IP may have spent tokens
+					for len(window.hits) < state.hits {
+						window.hits = append(window.hits, now)
+					}
+					if state.restriction > 0 {
+						blocked = true
+						policy.block(now.Add(state.restriction))
+					}
+				}
+				windows = append(windows, window)
+			}
+		}
+		policy.windows = windows
+	}
+
+	if retryAfter, err := strconv.Atoi(strings.TrimSpace(header.Get("Retry-After"))); err == nil {
+		blocked = true
+		policy.block(now.Add(time.Duration(retryAfter) * time.Second))
+	}
+
+	// Fall back to the penalty of a saturated window when GGG omits Retry-After
+	if resp.StatusCode == http.StatusTooManyRequests && !blocked {
+		retryAfter := defaultRetryAfter
+		for _, window := range policy.windows {
+			if len(window.hits) >= window.maxHits && window.restriction > retryAfter {
+				retryAfter = window.restriction
+			}
+		}
+		policy.block(now.Add(retryAfter))
+	}
+
+	// Only a 429 without known windows means the limits must be probed again
+	policy.probed = resp.StatusCode != http.StatusTooManyRequests || len(policy.windows) > 0
+}
+
+func (p *rateLimitPolicy) window(rule string, period time.Duration) *rateLimitWindow {
+	for _, window := range p.windows {
+		if window.rule == rule && window.period == period {
+			return window
+		}
+	}
+	return nil
+}
+
+func (p *rateLimitPolicy) block(until time.Time) {
+	if until.After(p.blockedUntil) {
+		p.blockedUntil = until
+	}
+}
+
+// Drops hits that are no longer within the window
+func (w *rateLimitWindow) prune(now time.Time) {
+	cutoff := now.Add(-w.period)
+	i := 0
+	for i < len(w.hits) && !w.hits[i].After(cutoff) {
+		i++
+	}
+	w.hits = w.hits[i:]
+}
+
+// Parses headers of the form "7:15:60,15:90:120,45:300:1800"
+func parseRateLimitRules(value string) []rateLimitRule {
+	entries := splitHeader(value)
+	rules := make([]rateLimitRule, 0, len(entries))
+	for _, entry := range entries {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 {
+			continue
+		}
+		hits, err := strconv.Atoi(parts[0])
+		if err != nil || hits <= 0 {
+			continue
+		}
+		period, err := strconv.Atoi(parts[1])
+		if err != nil || period <= 0 {
+			continue
+		}
+		restriction, err := strconv.Atoi(parts[2])
+		if err != nil {
+			continue
+		}
+		rules = append(rules, rateLimitRule{
+			hits:        hits,
+			period:      time.Duration(period) * time.Second,
+			restriction: time.Duration(restriction) * time.Second,
+		})
+	}
+	return rules
+}
+
+func splitHeader(value string) []string {
+	result := make([]string, 0, 3)
+	for _, el := range strings.Split(value, ",") {
+		el = strings.TrimSpace(el)
+		if el != "" {
+			result = append(result, el)
+		}
+	}
+	return result
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is only advanced explicitly so windows never refill during a test
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func rateLimitResponse(status int, headers map[string]string) *http.Response {
+	header := make(http.Header)
+	for key, value := range headers {
+		header.Set(key, value)
+	}
+	return &http.Response{StatusCode: status, Header: header}
+}
+
+// waitNow reports whether Wait returns without blocking
+func waitNow(t *testing.T, limiter *rateLimiter, key string) bool {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := limiter.Wait(ctx, key)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func TestParseRateLimitRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []rateLimitRule
+	}{
+		{"empty", "", []rateLimitRule{}},
+		{
+			"multiple windows",
+			"7:15:60, 15:90:120",
+			[]rateLimitRule{
+				{hits: 7, period: 15 * time.Second, restriction: 60 * time.Second},
+				{hits: 15, period: 90 * time.Second, restriction: 120 * time.Second},
+			},
+		},
+		{
+			"invalid entries are skipped",
+			"a:15:60,0:10:0,5:0:0,5:10,3:10:0",
+			[]rateLimitRule{{hits: 3, period: 10 * time.Second}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRateLimitRules(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRateLimitRules(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterWindowRefill(t *testing.T) {
+	clock := newFakeClock()
+	limiter := newRateLimiter()
+	limiter.now = clock.Now
+
+	// Limits are unknown until the first response
+	if !waitNow(t, limiter, exchangeEndpoint) {
+		t.Fatal("first request was delayed")
+	}
+	if waitNow(t, limiter, exchangeEndpoint) {
+		t.Fatal("second request was sent before the limits were known")
+	}
+	limiter.Update(exchangeEndpoint, rateLimitResponse(http.StatusOK, map[string]string{
+		"X-Rate-Limit-Rules":    "Ip",
+		"X-Rate-Limit-Ip":       "2:10:60",
+		"X-Rate-Limit-Ip-State": "1:10:0",
+	}))
+
+	if !waitNow(t, limiter, exchangeEndpoint) {
+		t.Fatal("request within the window was delayed")
+	}
+	if waitNow(t, limiter, exchangeEndpoint) {
+		t.Fatal("request exceeding the window was sent")
+	}
+	// Other endpoints are limited separately
+	if !waitNow(t, limiter, fetchEndpoint) {
+		t.Fatal("request to another endpoint was delayed")
+	}
+
+	clock.Advance(11 * time.Second)
+	if !waitNow(t, limiter, exchangeEndpoint) {
+		t.Fatal("request was delayed after the window refilled")
+	}
+}
+
+// Stand-ins without rate-limit headers must not serialize every request
+func TestRateLimiterWithoutHeaders(t *testing.T) {
+	clock := newFakeClock()
+	limiter := newRateLimiter()
+	limiter.now = clock.Now
+
+	if !waitNow(t, limiter, exchangeEndpoint) {
+		t.Fatal("first request was delayed")
+	}
+	if waitNow(t, limiter, exchangeEndpoint) {
+		t.Fatal("second request was sent before the first response")
+	}
+	limiter.Update(exchangeEndpoint, rateLimitResponse(http.StatusOK, nil))
+	for i := 0; i < 3; i++ {
+		if !waitNow(t, limiter, exchangeEndpoint) {
+			t.Fatalf("request %d was delayed without known limits", i+2)
+		}
+	}
+
+	// A 429 re-probes once the backoff passes
+	limiter.Update(exchangeEndpoint, rateLimitResponse(http.StatusTooManyRequests, nil))
+	clock.Advance(defaultRetryAfter + time.Second)
+	if !waitNow(t, limiter, exchangeEndpoint) {
+		t.Fatal("probe was delayed after the backoff")
+	}
+	if waitNow(t, limiter, exchangeEndpoint) {
+		t.Fatal("request was sent before the probe response")
+	}
+}
+
+func TestRateLimiterBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		want    time.Duration
+	}{
+		{"ok", http.StatusOK, nil, 0},
+		{"retry after", http.StatusTooManyRequests, map[string]string{"Retry-After": "30"}, 30 * time.Second},
+		{"429 without retry after", http.StatusTooManyRequests, nil, defaultRetryAfter},
+		{
+			"429 with a saturated window",
+			http.StatusTooManyRequests,
+			map[string]string{
+				"X-Rate-Limit-Rules":    "Ip",
+				"X-Rate-Limit-Ip":       "5:10:120",
+				"X-Rate-Limit-Ip-State": "5:10:0",
+			},
+			120 * time.Second,
+		},
+		{
+			"active restriction",
+			http.StatusOK,
+			map[string]string{
+				"X-Rate-Limit-Rules":    "Ip",
+				"X-Rate-Limit-Ip":       "5:10:120",
+				"X-Rate-Limit-Ip-State": "6:10:90",
+			},
+			90 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			limiter := newRateLimiter()
+			limiter.now = clock.Now
+
+			limiter.Update(exchangeEndpoint, rateLimitResponse(tt.status, tt.headers))
+			blockedUntil := limiter.policy(exchangeEndpoint).blockedUntil
+			var got time.Duration
+			if !blockedUntil.IsZero() {
+				got = blockedUntil.Sub(clock.Now())
+			}
+			if got != tt.want {
+				t.Errorf("blocked for %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientRetriesAfter429(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		attempt := requests
+		mu.Unlock()
+
+		w.Header().Set("X-Rate-Limit-Rules", "Ip")
+		w.Header().Set("X-Rate-Limit-Ip", "10:10:60")
+		w.Header().Set("X-Rate-Limit-Ip-State", fmt.Sprintf("%d:10:0", attempt))
+		if attempt == 1 {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"id":"query","result":["a","b"]}`)
+	}))
+	defer server.Close()
+
+	clock := newFakeClock()
+	client := NewClient(http.Client{}, server.URL, "Standard")
+	client.limiter.now = clock.Now
+
+	// The retry waits for Retry-After which never passes on the fake clock
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetBulkTrades(ctx, "chaos", "exalted", 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetBulkTrades() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	clock.Advance(31 * time.Second)
+	trades, err := client.GetBulkTrades(context.Background(), "chaos", "exalted", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trades.ID != "query" || len(trades.TradeIDs) != 2 {
+		t.Errorf("GetBulkTrades() = %+v", trades)
+	}
+	if requests != 2 {
+		t.Errorf("sent %d requests, want 2", requests)
+	}
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// recordedResponse is the on-disk format of a single exchange API call
+type recordedResponse struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	RequestBody string          `json:"requestBody,omitempty"`
+	QueryID     string          `json:"queryID,omitempty"`
+	Status      int             `json:"status"`
+	Header      http.Header     `json:"header"`
+	Body        json.RawMessage `json:"body"`
+}
+
+// recordingTransport saves every successful response to dir so the session
+// can be replayed later with replayTransport
+type recordingTransport struct {
+	next    http.RoundTripper
+	dir     string
+	baseURL string
+}
+
+// replayTransport serves responses saved by recordingTransport instead of
+// hitting the network
+type replayTransport struct {
+	dir     string
+	baseURL string
+}
+
+// NewRecordingClient creates a client that saves every exchange and fetch
+// response to dir
+func NewRecordingClient(httpClient http.Client, baseURL, league, dir string) (*Client, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	client := NewClient(httpClient, baseURL, league)
+	next := httpClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.client.Transport = &recordingTransport{
+		next:    next,
+		dir:     dir,
+		baseURL: client.baseURL,
+	}
+	return client, nil
+}
+
+// NewReplayClient creates a client that serves responses recorded by
+// NewRecordingClient from dir. Rate limits are not applied.
+func NewReplayClient(baseURL, league, dir string) (*Client, error) {
+	fileInfo, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fileInfo.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	client := NewClient(http.Client{}, baseURL, league)
+	client.client.Transport = &replayTransport{
+		dir:     dir,
+		baseURL: client.baseURL,
+	}
+	client.limiter = nil
+	return client, nil
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rate-limited and failed responses are not worth replaying
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if !json.Valid(body) {
+		return resp, nil
+	}
+
+	relativeURL := strings.TrimPrefix(req.URL.String(), t.baseURL)
+	recorded := recordedResponse{
+		Method:      req.Method,
+		URL:         relativeURL,
+		RequestBody: requestBody,
+		QueryID:     getQueryID(req, body),
+		Status:      resp.StatusCode,
+		Header:      resp.Header,
+		Body:        body,
+	}
+	if err := writeRecordedResponse(t.dir, recordingFileName(req.Method, relativeURL, requestBody), recorded); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	relativeURL := strings.TrimPrefix(req.URL.String(), t.baseURL)
+	fileName := recordingFileName(req.Method, relativeURL, requestBody)
+	content, err := os.ReadFile(filepath.Join(t.dir, fileName))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no recorded response for %s %s", req.Method, relativeURL)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var recorded recordedResponse
+	if err := json.Unmarshal(content, &recorded); err != nil {
+		return nil, fmt.Errorf("invalid recording %s: %w", fileName, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header,
+		Body:          io.NopCloser(bytes.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Reads the request body while leaving it intact for the next transport
+func readRequestBody(req *http.Request) (string, error) {
+	if req.Body == nil {
+		return "", nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return string(body), nil
+}
+
+// Exchange queries return the query ID in the response while fetch requests
+// provide it as a query param
+func getQueryID(req *http.Request, body []byte) string {
+	if queryID := req.URL.Query().Get("query"); queryID != "" {
+		return queryID
+	}
+	var trades Trades
+	if err := json.Unmarshal(body, &trades); err != nil {
+		return ""
+	}
+	return trades.ID
+}
+
+// File names are derived from the request so that replays can locate them
+// (e.g. exchange-1f2e3d4c5b6a7980.json)
+func recordingFileName(method, relativeURL, requestBody string) string {
+	endpoint := strings.SplitN(relativeURL, "/", 2)[0]
+	hash := sha256.Sum256([]byte(method + " " + relativeURL + "\n" + requestBody))
+	return endpoint + "-" + hex.EncodeToString(hash[:8]) + ".json"
+}
+
+func writeRecordedResponse(dir, fileName string, recorded recordedResponse) error {
+	content, err := json.MarshalIndent(recorded, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so replays never see partial recordings
+	tempFile, err := os.CreateTemp(dir, fileName+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tempFile.Write(content); err != nil {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		os.Remove(tempFile.Name())
+		return err
+	}
+	return os.Rename(tempFile.Name(), filepath.Join(dir, fileName))
+}
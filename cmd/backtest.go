@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/history"
+	"github.com/t73liu/poe-arbitrage/strategy"
+	"github.com/t73liu/poe-arbitrage/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var backtestCmd = &cobra.Command{
+	Use:   "backtest",
+	Short: "Replay recorded order books to evaluate trading paths",
+	Long: `
+Run the strategy against every order book snapshot recorded in the history
+file and simulate executing the detected opportunities. A trade is only
+filled if the listing is still available after --latency and the seller
+accepts the whisper (--fill-probability).
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var config Config
+		if err := viper.Unmarshal(&config); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse config:", err)
+			return err
+		}
+
+		items, err := cmd.Flags().GetStringSlice("items")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --items:", err)
+			return err
+		}
+		if len(items) == 1 {
+			return errors.New("provide at least 2 --items")
+		}
+		if err := validateItems(items, "Invalid items: "); err != nil {
+			return err
+		}
+
+		initialCapital, err := cmd.Flags().GetStringToInt("capital")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not parse --capital argument:", err)
+			return err
+		}
+		capitalItems := make([]string, 0, len(initialCapital))
+		for item := range initialCapital {
+			capitalItems = append(capitalItems, item)
+		}
+		if err := validateItems(capitalItems, "Invalid capital: "); err != nil {
+			return err
+		}
+
+		options, err := parseStrategyOptions(cmd, config, cycleMinLegs)
+		if err != nil {
+			return err
+		}
+
+		backtestOptions, err := parseBacktestOptions(cmd)
+		if err != nil {
+			return err
+		}
+
+		from, to, err := parseTimeRange(cmd, defaultLookback)
+		if err != nil {
+			return err
+		}
+
+		outputFormat, err := cmd.Flags().GetString("output")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --output:", err)
+			return err
+		}
+		outputFormat, err = parseOutputFormat(outputFormat)
+		if err != nil {
+			return err
+		}
+
+		historyFile, err := cmd.Flags().GetString("history")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --history:", err)
+			return err
+		}
+		historyStore, err := openHistory(historyFile, config)
+		if err != nil {
+			return err
+		}
+		if historyStore == nil {
+			return errors.New("no history file configured, use --history or set historyFile in the config")
+		}
+		defer historyStore.Close()
+
+		records, err := historyStore.Query(getLeague(config), from, to)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to query history:", err)
+			return err
+		}
+
+		snapshots, err := buildSnapshots(records, items, initialCapital, options)
+		if err != nil {
+			return err
+		}
+		if len(snapshots) == 0 {
+			return errors.New("no order books recorded in the time range")
+		}
+		fmt.Fprintf(os.Stderr, "Replaying %d snapshots\n", len(snapshots))
+
+		results, err := strategy.Backtest(snapshots, backtestOptions)
+		if err != nil {
+			return err
+		}
+		return writeBacktestResults(os.Stdout, outputFormat, results)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backtestCmd)
+
+	addStrategyFlags(backtestCmd)
+	addTimeRangeFlags(backtestCmd, defaultLookback)
+
+	backtestCmd.Flags().StringSlice(
+		"items",
+		nil,
+		"Only trade these items (default is every recorded item)",
+	)
+
+	backtestCmd.Flags().Float64(
+		"fill-probability",
+		0.8,
+		"Probability that a seller accepts a whisper",
+	)
+
+	backtestCmd.Flags().Duration(
+		"latency",
+		time.Minute,
+		"Time between detecting and executing an opportunity",
+	)
+
+	backtestCmd.Flags().Int64(
+		"seed",
+		1,
+		"Seed of the simulated whisper responses",
+	)
+
+	backtestCmd.Flags().String(
+		"history",
+		"",
+		"History file (default is historyFile in the config)",
+	)
+
+	backtestCmd.Flags().StringP(
+		"output",
+		"o",
+		tableOutput,
+		"Output format (table, csv, json or ndjson)",
+	)
+}
+
+func parseBacktestOptions(cmd *cobra.Command) (strategy.BacktestOptions, error) {
+	fillProbability, err := cmd.Flags().GetFloat64("fill-probability")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --fill-probability:", err)
+		return strategy.BacktestOptions{}, err
+	}
+	if fillProbability < 0 || fillProbability > 1 {
+		return strategy.BacktestOptions{}, errors.New("--fill-probability must be between 0 and 1")
+	}
+
+	latency, err := cmd.Flags().GetDuration("latency")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --latency:", err)
+		return strategy.BacktestOptions{}, err
+	}
+	if latency < 0 {
+		return strategy.BacktestOptions{}, errors.New("--latency cannot be negative")
+	}
+
+	seed, err := cmd.Flags().GetInt64("seed")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --seed:", err)
+		return strategy.BacktestOptions{}, err
+	}
+
+	return strategy.BacktestOptions{
+		FillProbability: fillProbability,
+		Latency:         latency,
+		Seed:            seed,
+	}, nil
+}
+
+// buildSnapshots groups the records of a single scan into a snapshot. Records
+// of items not in items are ignored unless items is empty.
+func buildSnapshots(
+	records []history.Record,
+	items []string,
+	capital map[string]int,
+	options strategy.Options,
+) ([]strategy.Snapshot, error) {
+	snapshots := make([]strategy.Snapshot, 0)
+	for _, record := range records {
+		if len(items) > 0 && (!utils.Contains(items, record.Have) || !utils.Contains(items, record.Want)) {
+			continue
+		}
+
+		last := len(snapshots) - 1
+		if last < 0 || !snapshots[last].Time.Equal(record.Time) {
+			snapshots = append(snapshots, strategy.Snapshot{
+				Time:         record.Time,
+				TradingPaths: strategy.NewTradingPaths(capital, options),
+			})
+			last++
+		}
+		listings := record.Listings
+		if err := snapshots[last].TradingPaths.Set(record.Have, record.Want, &listings); err != nil {
+			return nil, err
+		}
+	}
+	return snapshots, nil
+}
+
+func writeBacktestResults(w io.Writer, format string, results []strategy.BacktestResult) error {
+	switch format {
+	case jsonOutput:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	case ndjsonOutput:
+		encoder := json.NewEncoder(w)
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	columns := []string{"path", "start", "detections", "hits", "hitRate", "pnl", "maxDrawdown"}
+	rows := make([][]string, 0, len(results))
+	for _, result := range results {
+		rows = append(rows, []string{
+			result.Key,
+			result.StartItem,
+			strconv.Itoa(result.Detections),
+			strconv.Itoa(result.Hits),
+			strconv.FormatFloat(result.HitRate, 'f', 3, 64),
+			strconv.FormatFloat(result.PnL, 'f', 2, 64),
+			strconv.FormatFloat(result.MaxDrawdown, 'f', 2, 64),
+		})
+	}
+
+	return writeRows(w, format, columns, rows, "No opportunities detected.")
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/t73liu/poe-arbitrage/strategy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var convertCmd = &cobra.Command{
+	Use:   "convert FROM TO",
+	Short: "Find the best route to convert an amount of one item into another",
+	Long: `
+Find the route (direct or through the --via items) that converts --amount
+of FROM into the most TO, accounting for listing stock and lot sizes.
+`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("provide the FROM and TO items")
+		}
+		return validateItems(args, "Invalid arguments: ")
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var config Config
+		if err := viper.Unmarshal(&config); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse config:", err)
+			return err
+		}
+		from, to := args[0], args[1]
+
+		amount, err := cmd.Flags().GetUint("amount")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --amount:", err)
+			return err
+		}
+		if amount == 0 {
+			return errors.New("--amount must be at least 1")
+		}
+
+		via, err := cmd.Flags().GetStringSlice("via")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --via:", err)
+			return err
+		}
+		items := append([]string{from}, via...)
+		items = append(items, to)
+		if err := validateItems(items, "Invalid --via"); err != nil {
+			return err
+		}
+
+		outputFormat, err := cmd.Flags().GetString("output")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --output:", err)
+			return err
+		}
+		outputFormat, err = parseOutputFormat(outputFormat)
+		if err != nil {
+			return err
+		}
+		if outputFormat != textOutput && outputFormat != jsonOutput {
+			return fmt.Errorf("convert does not support %s output", outputFormat)
+		}
+
+		scan, err := newTradeScan(cmd, items, config, routeMinLegs)
+		if err != nil {
+			return err
+		}
+
+		tradingPaths, _, err := scan.fetchPairs(cmd.Context(), conversionPairs(items, from, to))
+		if err != nil {
+			return err
+		}
+
+		route, ok := tradingPaths.BestRoute(from, to, amount)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "No route found to convert %d %s into %s.\n", amount, from, to)
+			return nil
+		}
+		return writeRoute(os.Stdout, outputFormat, route, scan.flags())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+
+	addScanFlags(convertCmd)
+	// Only apply to cycles
+	for _, flag := range []string{"capital", "algorithm", "min-gain-percent", "min-gain", "reference", "must-include"} {
+		convertCmd.Flags().MarkHidden(flag)
+	}
+
+	convertCmd.Flags().Uint(
+		"amount",
+		0,
+		"Amount of FROM to convert",
+	)
+	convertCmd.MarkFlagRequired("amount")
+
+	convertCmd.Flags().StringSlice(
+		"via",
+		nil,
+		"Intermediate items to consider (i.e. exa,gcp)",
+	)
+
+	convertCmd.Flags().StringP(
+		"output",
+		"o",
+		textOutput,
+		"Output format (text or json)",
+	)
+}
+
+// conversionPairs returns the pairs between items that can be part of a route,
+// i.e. excluding pairs that buy FROM or sell TO
+func conversionPairs(items []string, from, to string) []strategy.TradingPair {
+	pairs := make([]strategy.TradingPair, 0, len(items)*(len(items)-1))
+	for _, pair := range allTradingPairs(items) {
+		if pair.TargetItem != from && pair.InitialItem != to {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// flaggedRoute adds the flags of the listings filled by a route
+type flaggedRoute struct {
+	strategy.Route
+	Flags listingFlags `json:"flags,omitempty"`
+}
+
+func writeRoute(w io.Writer, format string, route strategy.Route, flags listingFlags) error {
+	if format == jsonOutput {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(flaggedRoute{Route: route, Flags: flags.forLegs(route.Legs)})
+	}
+
+	fmt.Fprintln(w, "Route:", route.Key())
+	for _, leg := range route.Legs {
+		for _, fill := range leg.Fills {
+			printFill(w, fill, flags.get(leg.Pair, fill.Listing))
+		}
+		if len(leg.Fills) > 1 {
+			fmt.Fprintf(
+				w,
+				"Leg total: %d %s => %d %s (Ratio: %.3f)\n",
+				leg.PayAmount,
+				leg.Pair.InitialItem,
+				leg.ReceiveAmount,
+				leg.Pair.TargetItem,
+				leg.Ratio,
+			)
+		}
+	}
+	fmt.Fprintf(w, "\nConvert: %d %s => %d %s\n", route.InputAmount, route.From, route.OutputAmount, route.To)
+	fmt.Fprintln(w, "Trade windows:", route.TradeWindows)
+
+	leftoverItems := make([]string, 0, len(route.Leftovers))
+	for item := range route.Leftovers {
+		leftoverItems = append(leftoverItems, item)
+	}
+	sort.Strings(leftoverItems)
+	for _, item := range leftoverItems {
+		fmt.Fprintf(w, "Leftover: %d %s\n", route.Leftovers[item], item)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/strategy"
+	"github.com/t73liu/poe-arbitrage/utils"
+)
+
+// fetchOptions configures how listings are retrieved for every trading pair
+type fetchOptions struct {
+	// Max number of listings fetched per trading pair
+	depth uint
+	// Number of trading pairs fetched concurrently, the rate limiter is shared
+	workers int
+	// Optional, flags bait listings of every fetched trading pair
+	outliers *outlierFilter
+	// Optional, filters and sorts listings by the reputation of their seller
+	reputation *reputation
+}
+
+type pairListings struct {
+	pair         strategy.TradingPair
+	tradeDetails *[]api.TradeDetail
+	err          error
+}
+
+// allTradingPairs returns every ordered pair of items
+func allTradingPairs(items []string) []strategy.TradingPair {
+	pairs := make([]strategy.TradingPair, 0, len(items)*(len(items)-1))
+	for initialIndex, initialItem := range items {
+		for currIndex, currItem := range items {
+			if currIndex != initialIndex {
+				pairs = append(pairs, strategy.TradingPair{
+					InitialItem: initialItem,
+					TargetItem:  currItem,
+				})
+			}
+		}
+	}
+	return pairs
+}
+
+// fetchTradingPaths queries every trading pair with a pool of workers and
+// stores the filtered listings in tradingPaths. Pairs that fail are logged,
+// skipped and returned. Cancelling ctx stops the remaining requests but keeps
+// the pairs fetched so far.
+func fetchTradingPaths(
+	ctx context.Context,
+	exchange api.Exchange,
+	pairs []strategy.TradingPair,
+	tradingPaths *strategy.TradingPaths,
+	options fetchOptions,
+	config Config,
+) ([]strategy.TradingPair, error) {
+	workers := options.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan strategy.TradingPair)
+	results := make(chan pairListings)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pair := range jobs {
+				tradeDetails, err := fetchPairListings(ctx, exchange, pair, options, config)
+				results <- pairListings{
+					pair:         pair,
+					tradeDetails: tradeDetails,
+					err:          err,
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(results)
+		defer wg.Wait()
+		defer close(jobs)
+		for _, pair := range pairs {
+			select {
+			case jobs <- pair:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Results are only collected here so tradingPaths is never shared
+	fetched := 0
+	failedPairs := make([]strategy.TradingPair, 0)
+	for result := range results {
+		fetched++
+		pair := result.pair
+		if result.err != nil {
+			failedPairs = append(failedPairs, pair)
+			// Cancelled pairs are summarized below
+			if ctx.Err() != nil {
+				continue
+			}
+			fmt.Fprintf(
+				os.Stderr,
+				"[%d/%d] Skipping %s => %s: %v\n",
+				fetched,
+				len(pairs),
+				pair.InitialItem,
+				pair.TargetItem,
+				result.err,
+			)
+			continue
+		}
+
+		// Flagged after filterTradeDetails but on a single goroutine since
+		// repeat offenders are tracked across trading pairs
+		result.tradeDetails = options.outliers.apply(pair, result.tradeDetails)
+		fmt.Fprintf(
+			os.Stderr,
+			"[%d/%d] Fetched %s => %s (%d listings)\n",
+			fetched,
+			len(pairs),
+			pair.InitialItem,
+			pair.TargetItem,
+			len(*result.tradeDetails),
+		)
+		if len(*result.tradeDetails) > 0 {
+			if err := tradingPaths.Set(pair.InitialItem, pair.TargetItem, result.tradeDetails); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+
+	succeeded := fetched - len(failedPairs)
+	if ctx.Err() != nil {
+		if succeeded == 0 {
+			return failedPairs, ctx.Err()
+		}
+		fmt.Fprintf(os.Stderr, "Interrupted, analyzing %d/%d trading pairs\n", succeeded, len(pairs))
+		return failedPairs, nil
+	}
+	if succeeded == 0 {
+		return failedPairs, errors.New("unable to fetch any trading pairs")
+	}
+	return failedPairs, nil
+}
+
+func fetchPairListings(
+	ctx context.Context,
+	exchange api.Exchange,
+	pair strategy.TradingPair,
+	options fetchOptions,
+	config Config,
+) (*[]api.TradeDetail, error) {
+	bulkTrades, err := exchange.GetBulkTrades(ctx, pair.InitialItem, pair.TargetItem, 1)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch bulk trades: %w", err)
+	}
+
+	tradeDetails, err := exchange.GetTradeDetails(
+		ctx,
+		bulkTrades.ID,
+		utils.Limit(bulkTrades.TradeIDs, int(options.depth)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch trade details: %w", err)
+	}
+
+	tradeDetails = filterTradeDetails(tradeDetails, config, options.reputation)
+	sortTrades(tradeDetails, config, options.reputation)
+	return tradeDetails, nil
+}
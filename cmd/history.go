@@ -0,0 +1,324 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/history"
+	"github.com/t73liu/poe-arbitrage/strategy"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history HAVE WANT",
+	Short: "Show the recorded order book history of a trading pair",
+	Long: `
+Show the best bid/ask, spread and depth of a trading pair over time.
+Order books are recorded by trade and serve when a history file is
+configured (i.e. "historyFile" in the config or --history).
+`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("provide the HAVE and WANT items")
+		}
+		return validateItems(args, "Invalid arguments: ")
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var config Config
+		if err := viper.Unmarshal(&config); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse config:", err)
+			return err
+		}
+
+		historyFile, err := cmd.Flags().GetString("history")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --history:", err)
+			return err
+		}
+		historyStore, err := openHistory(historyFile, config)
+		if err != nil {
+			return err
+		}
+		if historyStore == nil {
+			return errors.New("no history file configured, use --history or set historyFile in the config")
+		}
+		defer historyStore.Close()
+
+		from, to, err := parseTimeRange(cmd, defaultLookback)
+		if err != nil {
+			return err
+		}
+
+		outputFormat, err := cmd.Flags().GetString("output")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --output:", err)
+			return err
+		}
+		outputFormat, err = parseOutputFormat(outputFormat)
+		if err != nil {
+			return err
+		}
+
+		records, err := historyStore.Query(getLeague(config), from, to)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to query history:", err)
+			return err
+		}
+
+		pairRecords := make([]history.Record, 0, len(records))
+		for _, record := range records {
+			if record.Have == args[0] && record.Want == args[1] {
+				pairRecords = append(pairRecords, record)
+			}
+		}
+		return writeHistory(os.Stdout, outputFormat, pairRecords)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().String(
+		"history",
+		"",
+		"History file (default is historyFile in the config)",
+	)
+
+	addTimeRangeFlags(historyCmd, defaultLookback)
+
+	historyCmd.Flags().StringP(
+		"output",
+		"o",
+		tableOutput,
+		"Output format (table, csv, json or ndjson)",
+	)
+}
+
+// Records older than the retention are pruned at most this often
+const historyPruneInterval = time.Hour
+
+// resolveHistoryFile returns the history file, --history takes precedence over
+// the config. Returns an empty string if neither is set.
+func resolveHistoryFile(historyFile string, config Config) (string, error) {
+	historyFile = strings.TrimSpace(historyFile)
+	if historyFile == "" {
+		historyFile = strings.TrimSpace(config.HistoryFile)
+	}
+	if historyFile == "" {
+		return "", nil
+	}
+
+	historyFile, err := homedir.Expand(historyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid history file:", err)
+		return "", err
+	}
+	return historyFile, nil
+}
+
+// openHistory opens the history file read-only so that it can be queried while
+// trade --watch or serve record to it. Returns nil if no file is configured.
+func openHistory(historyFile string, config Config) (*history.Store, error) {
+	historyFile, err := resolveHistoryFile(historyFile, config)
+	if err != nil || historyFile == "" {
+		return nil, err
+	}
+	historyStore, err := history.OpenReadOnly(historyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to open history file:", err)
+		return nil, err
+	}
+	return historyStore, nil
+}
+
+// historyRecorder saves the order books of every scan. The file is only open
+// while saving so that other commands can read it between scans.
+type historyRecorder struct {
+	file string
+	// Records older than this many days are pruned, disabled if 0
+	retentionDays int
+	lastPrune     time.Time
+}
+
+// newHistoryRecorder checks that the history file can be written and applies
+// the retention policy. Returns nil if no file is configured.
+func newHistoryRecorder(historyFile string, config Config) (*historyRecorder, error) {
+	historyFile, err := resolveHistoryFile(historyFile, config)
+	if err != nil || historyFile == "" {
+		return nil, err
+	}
+	recorder := &historyRecorder{
+		file:          historyFile,
+		retentionDays: config.HistoryRetentionDays,
+	}
+	historyStore, err := history.Open(historyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to open history file:", err)
+		return nil, err
+	}
+	defer historyStore.Close()
+	if err := recorder.prune(historyStore, time.Now()); err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to prune history:", err)
+		return nil, err
+	}
+	return recorder, nil
+}
+
+// record saves the order book of every trading pair and prunes the history if
+// historyPruneInterval passed since the last prune
+func (r *historyRecorder) record(scanTime time.Time, tradingPaths *strategy.TradingPaths, config Config) error {
+	historyStore, err := history.Open(r.file)
+	if err != nil {
+		return err
+	}
+	defer historyStore.Close()
+
+	if err := historyStore.Save(historyRecords(scanTime, tradingPaths, config)); err != nil {
+		return err
+	}
+	if scanTime.Sub(r.lastPrune) < historyPruneInterval {
+		return nil
+	}
+	return r.prune(historyStore, scanTime)
+}
+
+func (r *historyRecorder) prune(historyStore *history.Store, now time.Time) error {
+	if r.retentionDays <= 0 {
+		return nil
+	}
+	if _, err := historyStore.Prune(now.AddDate(0, 0, -r.retentionDays)); err != nil {
+		return err
+	}
+	r.lastPrune = now
+	return nil
+}
+
+// historyRecords summarizes the order book of every trading pair
+func historyRecords(scanTime time.Time, tradingPaths *strategy.TradingPaths, config Config) []history.Record {
+	league := getLeague(config)
+	tradingPairs := tradingPaths.TradingPairs()
+	records := make([]history.Record, 0, len(tradingPairs))
+	for _, pair := range tradingPairs {
+		listings := tradingPaths.Get(pair.InitialItem, pair.TargetItem)
+		var reverseListings []api.TradeDetail
+		if reverse := tradingPaths.Get(pair.TargetItem, pair.InitialItem); reverse != nil {
+			reverseListings = *reverse
+		}
+		records = append(records, history.NewRecord(
+			scanTime,
+			league,
+			pair.InitialItem,
+			pair.TargetItem,
+			*listings,
+			reverseListings,
+		))
+	}
+	return records
+}
+
+// Time range covered by history and backtest when --from is not set
+const defaultLookback = 24 * time.Hour
+
+// addTimeRangeFlags adds --from and --to, --from defaults to lookback before
+// --to or to the first record if lookback is 0
+func addTimeRangeFlags(cmd *cobra.Command, lookback time.Duration) {
+	fromDefault := "the first record"
+	if lookback > 0 {
+		fromDefault = fmt.Sprintf("%.0f hours ago", lookback.Hours())
+	}
+	cmd.Flags().String(
+		"from",
+		"",
+		"Start of the time range, RFC3339 or YYYY-MM-DD (default is "+fromDefault+")",
+	)
+
+	cmd.Flags().String(
+		"to",
+		"",
+		"End of the time range, RFC3339 or YYYY-MM-DD (default is now)",
+	)
+}
+
+func parseTimeRange(cmd *cobra.Command, lookback time.Duration) (from, to time.Time, err error) {
+	fromFlag, err := cmd.Flags().GetString("from")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --from:", err)
+		return from, to, err
+	}
+	toFlag, err := cmd.Flags().GetString("to")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --to:", err)
+		return from, to, err
+	}
+
+	to = time.Now()
+	if strings.TrimSpace(toFlag) != "" {
+		if to, err = parseTime(toFlag); err != nil {
+			return from, to, fmt.Errorf("invalid --to: %w", err)
+		}
+	}
+	if lookback > 0 {
+		from = to.Add(-lookback)
+	}
+	if strings.TrimSpace(fromFlag) != "" {
+		if from, err = parseTime(fromFlag); err != nil {
+			return from, to, fmt.Errorf("invalid --from: %w", err)
+		}
+	}
+	if from.After(to) {
+		return from, to, errors.New("--from must be before --to")
+	}
+	return from, to, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+func writeHistory(w io.Writer, format string, records []history.Record) error {
+	switch format {
+	case jsonOutput:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case ndjsonOutput:
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	columns := []string{"time", "bid", "ask", "spread", "depth", "stock", "totalStock", "seller"}
+	rows := make([][]string, 0, len(records))
+	for _, record := range records {
+		rows = append(rows, []string{
+			record.Time.Format(time.RFC3339),
+			strconv.FormatFloat(record.Bid, 'f', 4, 64),
+			strconv.FormatFloat(record.Ask, 'f', 4, 64),
+			strconv.FormatFloat(record.Spread(), 'f', 4, 64),
+			strconv.Itoa(record.Depth),
+			strconv.FormatUint(uint64(record.Stock), 10),
+			strconv.FormatUint(uint64(record.TotalStock), 10),
+			record.Seller,
+		})
+	}
+
+	return writeRows(w, format, columns, rows, "No history recorded.")
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/history"
+	"github.com/t73liu/poe-arbitrage/strategy"
+)
+
+func countRecords(t *testing.T, historyFile string) int {
+	t.Helper()
+	historyStore, err := history.OpenReadOnly(historyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer historyStore.Close()
+	records, err := historyStore.Query("Standard", time.Time{}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(records)
+}
+
+func saveRecord(t *testing.T, historyFile string, recordTime time.Time) {
+	t.Helper()
+	historyStore, err := history.Open(historyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer historyStore.Close()
+	record := history.NewRecord(recordTime, "Standard", "chaos", "exalted", nil, nil)
+	if err := historyStore.Save([]history.Record{record}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHistoryRecorder(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "history.db")
+	config := Config{League: "Standard", HistoryRetentionDays: 1}
+	saveRecord(t, historyFile, time.Now().AddDate(0, 0, -2))
+
+	// Expired records are pruned on startup
+	recorder, err := newHistoryRecorder(historyFile, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countRecords(t, historyFile); got != 0 {
+		t.Fatalf("%d records left after pruning on startup, want 0", got)
+	}
+
+	tradingPaths := strategy.NewTradingPaths(nil, strategy.Options{})
+	listings := []api.TradeDetail{tradeDetail("a", "a", 10, 1, 100)}
+	if err := tradingPaths.Set("chaos", "exalted", &listings); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pruning is skipped until historyPruneInterval passes
+	saveRecord(t, historyFile, time.Now().AddDate(0, 0, -2))
+	if err := recorder.record(time.Now(), tradingPaths, config); err != nil {
+		t.Fatal(err)
+	}
+	if got := countRecords(t, historyFile); got != 2 {
+		t.Errorf("%d records after the first scan, want 2", got)
+	}
+
+	if err := recorder.record(time.Now().Add(historyPruneInterval), tradingPaths, config); err != nil {
+		t.Fatal(err)
+	}
+	if got := countRecords(t, historyFile); got != 2 {
+		t.Errorf("%d records after pruning, want 2", got)
+	}
+
+	// The file is released between scans
+	historyStore, err := history.Open(historyFile)
+	if err != nil {
+		t.Fatalf("history file is still held by the recorder: %v", err)
+	}
+	historyStore.Close()
+}
@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/journal"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var journalCmd = &cobra.Command{
+	Use:   "journal",
+	Short: "Track the outcome of whispers sent to sellers",
+	Long: `
+Record whether sellers completed, ignored or failed trades. The resulting
+completion rate of every account breaks ties between listings of the same
+ratio and accounts are ignored after "autoIgnoreFailures" consecutive
+ignored or failed whispers (0 disables).
+`,
+}
+
+var journalMarkCmd = &cobra.Command{
+	Use:   "mark ACCOUNT OUTCOME",
+	Short: "Record the outcome (completed, ignored or failed) of a whisper",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("provide the ACCOUNT and OUTCOME")
+		}
+		if strings.TrimSpace(args[0]) == "" {
+			return errors.New("ACCOUNT cannot be empty")
+		}
+		_, err := journal.ParseOutcome(args[1])
+		return err
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var config Config
+		if err := viper.Unmarshal(&config); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse config:", err)
+			return err
+		}
+		outcome, err := journal.ParseOutcome(args[1])
+		if err != nil {
+			return err
+		}
+
+		have, err := cmd.Flags().GetString("have")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --have:", err)
+			return err
+		}
+		want, err := cmd.Flags().GetString("want")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --want:", err)
+			return err
+		}
+		note, err := cmd.Flags().GetString("note")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --note:", err)
+			return err
+		}
+
+		whisper := journal.Whisper{
+			Time:    time.Now(),
+			Account: strings.TrimSpace(args[0]),
+			Outcome: outcome,
+			Have:    strings.TrimSpace(have),
+			Want:    strings.TrimSpace(want),
+			Note:    note,
+		}
+
+		journalStore, err := openRequiredJournal(cmd, config)
+		if err != nil {
+			return err
+		}
+		defer journalStore.Close()
+
+		stats, err := journalStore.RecordWhisper(whisper)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to record whisper:", err)
+			return err
+		}
+		printAccountStats(os.Stdout, stats)
+		if config.AutoIgnoreFailures > 0 && stats.ConsecutiveFailures == config.AutoIgnoreFailures {
+			fmt.Printf(
+				"%s is now ignored after %d consecutive failures, mark a completed trade to undo.\n",
+				stats.Account,
+				stats.ConsecutiveFailures,
+			)
+		}
+		return nil
+	},
+}
+
+var journalStatsCmd = &cobra.Command{
+	Use:   "stats [ACCOUNT]",
+	Short: "Show the response and completion rate of accounts",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var config Config
+		if err := viper.Unmarshal(&config); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse config:", err)
+			return err
+		}
+
+		outputFormat, err := cmd.Flags().GetString("output")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --output:", err)
+			return err
+		}
+		outputFormat, err = parseOutputFormat(outputFormat)
+		if err != nil {
+			return err
+		}
+		if outputFormat != tableOutput && outputFormat != jsonOutput {
+			return fmt.Errorf("journal stats does not support %s output", outputFormat)
+		}
+
+		journalStore, err := openRequiredJournal(cmd, config)
+		if err != nil {
+			return err
+		}
+		defer journalStore.Close()
+
+		stats, err := journalStore.Stats()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to read journal:", err)
+			return err
+		}
+
+		accounts := make([]journal.AccountStats, 0, len(stats))
+		for _, accountStats := range stats {
+			if len(args) == 0 || accountStats.Account == args[0] {
+				accounts = append(accounts, accountStats)
+			}
+		}
+		sort.Slice(accounts, func(i, j int) bool {
+			return accounts[i].Account < accounts[j].Account
+		})
+		accountReputation := &reputation{
+			stats:              stats,
+			autoIgnoreFailures: config.AutoIgnoreFailures,
+		}
+		return writeAccountStats(os.Stdout, outputFormat, accounts, accountReputation)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(journalCmd)
+	journalCmd.AddCommand(journalMarkCmd)
+	journalCmd.AddCommand(journalStatsCmd)
+
+	journalCmd.PersistentFlags().String(
+		"journal",
+		"",
+		"Journal file (default is journalFile in the config)",
+	)
+
+	journalMarkCmd.Flags().String(
+		"have",
+		"",
+		"Item offered in the whisper",
+	)
+
+	journalMarkCmd.Flags().String(
+		"want",
+		"",
+		"Item requested in the whisper",
+	)
+
+	journalMarkCmd.Flags().String(
+		"note",
+		"",
+		"Free-form note (e.g. price changed)",
+	)
+
+	journalStatsCmd.Flags().StringP(
+		"output",
+		"o",
+		tableOutput,
+		"Output format (table or json)",
+	)
+}
+
+// resolveJournalFile returns the journal file, --journal takes precedence over
+// the config. Returns an empty string if neither is set.
+func resolveJournalFile(journalFile string, config Config) (string, error) {
+	journalFile = strings.TrimSpace(journalFile)
+	if journalFile == "" {
+		journalFile = strings.TrimSpace(config.JournalFile)
+	}
+	if journalFile == "" {
+		return "", nil
+	}
+
+	journalFile, err := homedir.Expand(journalFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid journal file:", err)
+		return "", err
+	}
+	return journalFile, nil
+}
+
+func openRequiredJournal(cmd *cobra.Command, config Config) (*journal.Store, error) {
+	journalFile, err := cmd.Flags().GetString("journal")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --journal:", err)
+		return nil, err
+	}
+	journalFile, err = resolveJournalFile(journalFile, config)
+	if err != nil {
+		return nil, err
+	}
+	if journalFile == "" {
+		return nil, errors.New("no journal file configured, use --journal or set journalFile in the config")
+	}
+
+	journalStore, err := journal.Open(journalFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to open journal file:", err)
+		return nil, err
+	}
+	return journalStore, nil
+}
+
+// reputation is a snapshot of the journal used to filter and sort listings
+type reputation struct {
+	stats map[string]journal.AccountStats
+	// Consecutive failures after which an account is ignored, disabled if 0
+	autoIgnoreFailures int
+}
+
+// loadReputation reads the stats of every account from journalFile. The file
+// is closed right away so that whispers can be marked while watching. Returns
+// nil if journalFile is empty.
+func loadReputation(journalFile string, config Config) (*reputation, error) {
+	if journalFile == "" {
+		return nil, nil
+	}
+	journalStore, err := journal.Open(journalFile)
+	if err != nil {
+		return nil, err
+	}
+	defer journalStore.Close()
+
+	stats, err := journalStore.Stats()
+	if err != nil {
+		return nil, err
+	}
+	return &reputation{
+		stats:              stats,
+		autoIgnoreFailures: config.AutoIgnoreFailures,
+	}, nil
+}
+
+// ignored returns true if the account failed too many consecutive whispers
+func (r *reputation) ignored(account string) bool {
+	if r == nil || r.autoIgnoreFailures <= 0 {
+		return false
+	}
+	return r.stats[account].ConsecutiveFailures >= r.autoIgnoreFailures
+}
+
+// score ranks accounts by completion rate, accounts without whispers are
+// ranked between reliable and unreliable accounts
+func (r *reputation) score(account string) float64 {
+	if r == nil {
+		return 0
+	}
+	stats, ok := r.stats[account]
+	if !ok || stats.Whispers == 0 {
+		return 0.5
+	}
+	return stats.CompletionRate()
+}
+
+func printAccountStats(w io.Writer, stats journal.AccountStats) {
+	fmt.Fprintf(
+		w,
+		"%s: %d whispers, %d completed, %d ignored, %d failed (Response rate: %.0f%%, Completion rate: %.0f%%)\n",
+		stats.Account,
+		stats.Whispers,
+		stats.Completed,
+		stats.Ignored,
+		stats.Failed,
+		stats.ResponseRate()*100,
+		stats.CompletionRate()*100,
+	)
+}
+
+func writeAccountStats(w io.Writer, format string, accounts []journal.AccountStats, reputation *reputation) error {
+	if format == jsonOutput {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(accounts)
+	}
+
+	if len(accounts) == 0 {
+		fmt.Fprintln(w, "No whispers recorded.")
+		return nil
+	}
+	columns := []string{"account", "whispers", "completed", "ignored", "failed", "responseRate", "completionRate", "lastWhisper", "autoIgnored"}
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.ToUpper(strings.Join(columns, "\t")))
+	for _, stats := range accounts {
+		fmt.Fprintln(writer, strings.Join([]string{
+			stats.Account,
+			strconv.Itoa(stats.Whispers),
+			strconv.Itoa(stats.Completed),
+			strconv.Itoa(stats.Ignored),
+			strconv.Itoa(stats.Failed),
+			strconv.FormatFloat(stats.ResponseRate(), 'f', 2, 64),
+			strconv.FormatFloat(stats.CompletionRate(), 'f', 2, 64),
+			stats.LastWhisper.Format(time.RFC3339),
+			strconv.FormatBool(reputation.ignored(stats.Account)),
+		}, "\t"))
+	}
+	return writer.Flush()
+}
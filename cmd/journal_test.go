@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/journal"
+)
+
+func TestWriteAccountStatsAutoIgnored(t *testing.T) {
+	stats := map[string]journal.AccountStats{
+		"flaky":    {Account: "flaky", Whispers: 3, Ignored: 3, ConsecutiveFailures: 3, LastWhisper: time.Now()},
+		"reliable": {Account: "reliable", Whispers: 2, Completed: 2, LastWhisper: time.Now()},
+	}
+	accounts := []journal.AccountStats{stats["flaky"], stats["reliable"]}
+
+	for _, tt := range []struct {
+		autoIgnoreFailures int
+		want               map[string]string
+	}{
+		{3, map[string]string{"flaky": "true", "reliable": "false"}},
+		{0, map[string]string{"flaky": "false", "reliable": "false"}},
+	} {
+		var out bytes.Buffer
+		accountReputation := &reputation{stats: stats, autoIgnoreFailures: tt.autoIgnoreFailures}
+		if err := writeAccountStats(&out, tableOutput, accounts, accountReputation); err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n")[1:] {
+			fields := strings.Fields(line)
+			account, autoIgnored := fields[0], fields[len(fields)-1]
+			if autoIgnored != tt.want[account] {
+				t.Errorf("autoIgnoreFailures=%d: %s autoIgnored = %s, want %s", tt.autoIgnoreFailures, account, autoIgnored, tt.want[account])
+			}
+		}
+	}
+}
+
+func TestFetchPairsWithLockedJournal(t *testing.T) {
+	journalFile := filepath.Join(t.TempDir(), "journal.db")
+	journalStore, err := journal.Open(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journalStore.Close()
+
+	scan := tradeScan{
+		exchange: fakeExchange{listings: map[string][]api.TradeDetail{
+			"chaos>exalted": {tradeDetail("a", "a", 10, 1, 100)},
+		}},
+		fetch:       fetchOptions{depth: 10},
+		journalFile: journalFile,
+	}
+	tradingPaths, _, err := scan.fetchPairs(context.Background(), allTradingPairs([]string{"chaos", "exalted"}))
+	if err != nil {
+		t.Fatalf("fetchPairs() failed while the journal was locked: %v", err)
+	}
+	if listings := tradingPaths.Get("chaos", "exalted"); listings == nil || len(*listings) != 1 {
+		t.Errorf("chaos => exalted listings = %v, want 1 listing", listings)
+	}
+}
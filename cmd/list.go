@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -14,13 +15,13 @@ var listCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		name, err := cmd.Flags().GetString("name")
 		if err != nil {
-			fmt.Println("Failed to retrieve --name value:", err)
+			fmt.Fprintln(os.Stderr, "Failed to retrieve --name value:", err)
 			return err
 		}
 
 		var config Config
 		if err := viper.Unmarshal(&config); err != nil {
-			fmt.Println("Failed to parse config:", err)
+			fmt.Fprintln(os.Stderr, "Failed to parse config:", err)
 			return err
 		}
 
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"math"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/strategy"
+	"github.com/t73liu/poe-arbitrage/utils"
+)
+
+// Flags set on suspicious listings
+const (
+	outlierFlag    = "outlier"
+	lowStockFlag   = "low-stock"
+	repeatBaitFlag = "repeat-bait"
+)
+
+// MAD is floored to this fraction of the median so that a book where most
+// sellers agree on a price does not flag every other listing
+const minRelativeMAD = 0.01
+
+// Bait listings are forgotten once they have not been flagged for this long
+// so that sellers are not flagged forever
+const baitMemory = time.Hour
+
+// listingFlags holds the reasons listings look like bait keyed by strategy.ListingKey
+type listingFlags map[string][]string
+
+// outlierFilter flags bait listings (i.e. prices far better than the rest of
+// the book or stock below the quoted amount) and remembers the sellers posting
+// them across trading pairs and scans. Only used by the goroutine collecting
+// fetch results.
+type outlierFilter struct {
+	// Listings priced better than the median ratio by more than this many
+	// median absolute deviations are outliers, disabled if 0
+	madThreshold float64
+	// Sellers with at least this many flagged listings are flagged on every
+	// listing, disabled if 0
+	repeatThreshold int
+	// Remove flagged listings instead of only flagging them
+	exclude bool
+
+	scanTime time.Time
+	// Flags of the current scan
+	flags listingFlags
+	// Last time every flagged listing of a seller was seen
+	baitListings map[string]map[string]time.Time
+}
+
+func newOutlierFilter(madThreshold float64, repeatThreshold int, exclude bool) *outlierFilter {
+	return &outlierFilter{
+		madThreshold:    madThreshold,
+		repeatThreshold: repeatThreshold,
+		exclude:         exclude,
+		flags:           make(listingFlags),
+		baitListings:    make(map[string]map[string]time.Time),
+	}
+}
+
+// startScan clears the flags of the previous scan and forgets bait listings
+// that were not seen within baitMemory of scanTime
+func (f *outlierFilter) startScan(scanTime time.Time) {
+	if f == nil {
+		return
+	}
+	f.scanTime = scanTime
+	f.flags = make(listingFlags)
+	for account, listings := range f.baitListings {
+		for key, lastSeen := range listings {
+			if scanTime.Sub(lastSeen) > baitMemory {
+				delete(listings, key)
+			}
+		}
+		if len(listings) == 0 {
+			delete(f.baitListings, account)
+		}
+	}
+}
+
+// scanFlags returns the flags of the current scan, nil if disabled
+func (f *outlierFilter) scanFlags() listingFlags {
+	if f == nil {
+		return nil
+	}
+	return f.flags
+}
+
+// apply flags the listings of a single trading pair, flagged listings are
+// removed if exclude is set
+func (f *outlierFilter) apply(pair strategy.TradingPair, tradeDetails *[]api.TradeDetail) *[]api.TradeDetail {
+	if f == nil {
+		return tradeDetails
+	}
+
+	ratios := make([]float64, 0, len(*tradeDetails))
+	for _, trade := range *tradeDetails {
+		ratios = append(ratios, trade.Ratio)
+	}
+	median, mad := medianAbsoluteDeviation(ratios)
+	mad = math.Max(mad, median*minRelativeMAD)
+	for _, trade := range *tradeDetails {
+		key := strategy.ListingKey(pair, trade)
+		// Only listings that are too good to be true are bait, overpriced
+		// listings are never filled anyway
+		if f.madThreshold > 0 && len(*tradeDetails) >= 3 && trade.Ratio-median > f.madThreshold*mad {
+			f.flags[key] = append(f.flags[key], outlierFlag)
+		}
+		if trade.Stock < trade.ItemAmount {
+			f.flags[key] = append(f.flags[key], lowStockFlag)
+		}
+		if len(f.flags[key]) > 0 {
+			if _, ok := f.baitListings[trade.Account]; !ok {
+				f.baitListings[trade.Account] = make(map[string]time.Time)
+			}
+			f.baitListings[trade.Account][key] = f.scanTime
+		}
+	}
+
+	filteredTrades := make([]api.TradeDetail, 0, len(*tradeDetails))
+	for _, trade := range *tradeDetails {
+		key := strategy.ListingKey(pair, trade)
+		if f.repeatThreshold > 0 && len(f.baitListings[trade.Account]) >= f.repeatThreshold {
+			f.flags[key] = append(f.flags[key], repeatBaitFlag)
+		}
+		if f.exclude && len(f.flags[key]) > 0 {
+			continue
+		}
+		filteredTrades = append(filteredTrades, trade)
+	}
+	return &filteredTrades
+}
+
+// get returns the flags of a listing of pair
+func (f listingFlags) get(pair strategy.TradingPair, trade api.TradeDetail) []string {
+	return f[strategy.ListingKey(pair, trade)]
+}
+
+// forLegs returns the flags of the listings filled by legs, nil if none are
+// flagged
+func (f listingFlags) forLegs(legs []strategy.Leg) listingFlags {
+	var result listingFlags
+	for _, leg := range legs {
+		for _, fill := range leg.Fills {
+			flags := f.get(leg.Pair, fill.Listing)
+			if len(flags) == 0 {
+				continue
+			}
+			if result == nil {
+				result = make(listingFlags)
+			}
+			result[strategy.ListingKey(leg.Pair, fill.Listing)] = flags
+		}
+	}
+	return result
+}
+
+// medianAbsoluteDeviation returns the median of ratios and the median of their
+// absolute deviations from it
+func medianAbsoluteDeviation(ratios []float64) (median, mad float64) {
+	if len(ratios) == 0 {
+		return 0, 0
+	}
+	median = utils.CalcMedian(ratios)
+
+	deviations := make([]float64, 0, len(ratios))
+	for _, ratio := range ratios {
+		deviations = append(deviations, math.Abs(ratio-median))
+	}
+	return median, utils.CalcMedian(deviations)
+}
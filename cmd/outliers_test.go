@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/strategy"
+)
+
+var outlierPair = strategy.TradingPair{InitialItem: "chaos", TargetItem: "gcp"}
+
+func TestMedianAbsoluteDeviation(t *testing.T) {
+	tests := []struct {
+		name       string
+		ratios     []float64
+		wantMedian float64
+		wantMAD    float64
+	}{
+		{"empty", nil, 0, 0},
+		{"odd", []float64{4, 1, 100, 3, 2}, 3, 1},
+		{"even", []float64{1, 2, 4, 10}, 3, 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			median, mad := medianAbsoluteDeviation(tt.ratios)
+			if median != tt.wantMedian || mad != tt.wantMAD {
+				t.Errorf("medianAbsoluteDeviation() = (%f, %f), want (%f, %f)", median, mad, tt.wantMedian, tt.wantMAD)
+			}
+		})
+	}
+}
+
+func TestOutlierFilterThresholds(t *testing.T) {
+	// Ratios of 1.5 and 0.5 are far from the median of 1
+	book := []api.TradeDetail{
+		tradeDetail("bait", "a", 100, 150, 1000),
+		tradeDetail("high", "b", 100, 101, 1000),
+		tradeDetail("median", "c", 100, 100, 1000),
+		tradeDetail("median2", "d", 100, 100, 1000),
+		tradeDetail("low", "e", 100, 99, 1000),
+		tradeDetail("overpriced", "f", 100, 50, 1000),
+	}
+	tests := []struct {
+		name         string
+		madThreshold float64
+		book         []api.TradeDetail
+		exclude      bool
+		want         listingFlags
+		wantListings int
+	}{
+		{
+			name:         "only better prices are outliers",
+			madThreshold: 3,
+			book:         book,
+			want:         listingFlags{"bait": {outlierFlag}},
+			wantListings: 6,
+		},
+		{
+			name:         "MAD floor",
+			madThreshold: 3,
+			// 2% better is within 3 MADs once the MAD is floored to 1%
+			book: []api.TradeDetail{
+				tradeDetail("better", "a", 100, 102, 1000),
+				tradeDetail("median", "b", 100, 100, 1000),
+				tradeDetail("median2", "c", 100, 100, 1000),
+			},
+			want:         listingFlags{},
+			wantListings: 3,
+		},
+		{
+			name:         "higher threshold",
+			madThreshold: 60,
+			book:         book,
+			want:         listingFlags{},
+			wantListings: 6,
+		},
+		{
+			name:         "disabled",
+			book:         book,
+			want:         listingFlags{},
+			wantListings: 6,
+		},
+		{
+			name:         "too few listings",
+			madThreshold: 3,
+			book:         book[:2],
+			want:         listingFlags{},
+			wantListings: 2,
+		},
+		{
+			name:         "low stock",
+			madThreshold: 3,
+			book:         []api.TradeDetail{tradeDetail("empty", "a", 100, 100, 50)},
+			want:         listingFlags{"empty": {lowStockFlag}},
+			wantListings: 1,
+		},
+		{
+			name:         "exclude flagged",
+			madThreshold: 3,
+			book:         book,
+			exclude:      true,
+			want:         listingFlags{"bait": {outlierFlag}},
+			wantListings: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := newOutlierFilter(tt.madThreshold, 0, tt.exclude)
+			filter.startScan(time.Now())
+			tradeDetails := append([]api.TradeDetail(nil), tt.book...)
+			filtered := filter.apply(outlierPair, &tradeDetails)
+			if !reflect.DeepEqual(filter.scanFlags(), tt.want) {
+				t.Errorf("flags = %v, want %v", filter.scanFlags(), tt.want)
+			}
+			if len(*filtered) != tt.wantListings {
+				t.Errorf("apply() kept %d listings, want %d", len(*filtered), tt.wantListings)
+			}
+		})
+	}
+}
+
+func TestOutlierFilterRepeatBait(t *testing.T) {
+	scanTime := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	filter := newOutlierFilter(0, 2, false)
+	scan := func(scanTime time.Time, listings ...api.TradeDetail) listingFlags {
+		t.Helper()
+		filter.startScan(scanTime)
+		filter.apply(outlierPair, &listings)
+		return filter.scanFlags()
+	}
+	bait := tradeDetail("bait", "a", 100, 100, 1)
+	clean := tradeDetail("clean", "a", 100, 100, 1000)
+
+	// The same bait listing seen in every scan only counts once
+	for i := 0; i < 3; i++ {
+		flags := scan(scanTime.Add(time.Duration(i)*time.Minute), bait, clean)
+		if got := flags.get(outlierPair, clean); len(got) != 0 {
+			t.Fatalf("scan %d flagged the clean listing with %v", i+1, got)
+		}
+	}
+
+	otherBait := tradeDetail("other", "a", 100, 100, 1)
+	flags := scan(scanTime.Add(5*time.Minute), otherBait, clean)
+	if got := flags.get(outlierPair, clean); !reflect.DeepEqual(got, []string{repeatBaitFlag}) {
+		t.Errorf("clean listing flags = %v, want %v", got, []string{repeatBaitFlag})
+	}
+	if got := flags.get(outlierPair, bait); len(got) != 0 {
+		t.Errorf("flags of the previous scan were kept: %v", got)
+	}
+
+	// Bait listings that are no longer seen are eventually forgotten
+	flags = scan(scanTime.Add(5*time.Minute+baitMemory+time.Second), clean)
+	if got := flags.get(outlierPair, clean); len(got) != 0 {
+		t.Errorf("clean listing flags = %v after the bait listings expired", got)
+	}
+}
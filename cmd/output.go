@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/strategy"
+)
+
+const (
+	textOutput   = "text"
+	jsonOutput   = "json"
+	ndjsonOutput = "ndjson"
+	csvOutput    = "csv"
+	tableOutput  = "table"
+)
+
+var outputFormats = []string{textOutput, jsonOutput, ndjsonOutput, csvOutput, tableOutput}
+
+// Columns shared by csv and table output, one row per fill
+var fillColumns = []string{
+	"opportunity",
+	"start",
+	"gain",
+	"profit",
+	"referenceCurrency",
+	"profitValue",
+	"capitalValue",
+	"input",
+	"output",
+	"tradeWindows",
+	"risk",
+	"riskAdjustedGain",
+	"leg",
+	"legRatio",
+	"pay",
+	"payItem",
+	"receive",
+	"receiveItem",
+	"stock",
+	"ratio",
+	"rounds",
+	"fillProbability",
+	"flags",
+	"account",
+	"whispers",
+}
+
+func parseOutputFormat(format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	for _, supportedFormat := range outputFormats {
+		if format == supportedFormat {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf(
+		"unsupported output format %q, expected one of %s",
+		format,
+		strings.Join(outputFormats, ", "),
+	)
+}
+
+// flaggedOpportunity adds the flags of the listings filled by an opportunity
+// to its JSON output
+type flaggedOpportunity struct {
+	strategy.Opportunity
+	Flags listingFlags `json:"flags,omitempty"`
+}
+
+// flaggedPlan adds the flags of the listings filled by every step
+type flaggedPlan struct {
+	strategy.Plan
+	Flags listingFlags `json:"flags,omitempty"`
+}
+
+func flagOpportunities(opportunities []strategy.Opportunity, flags listingFlags) []flaggedOpportunity {
+	flagged := make([]flaggedOpportunity, 0, len(opportunities))
+	for _, opportunity := range opportunities {
+		flagged = append(flagged, flaggedOpportunity{
+			Opportunity: opportunity,
+			Flags:       flags.forLegs(opportunity.Legs),
+		})
+	}
+	return flagged
+}
+
+func writeOpportunities(w io.Writer, format string, opportunities []strategy.Opportunity, flags listingFlags) error {
+	switch format {
+	case jsonOutput:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(flagOpportunities(opportunities, flags))
+	case ndjsonOutput:
+		encoder := json.NewEncoder(w)
+		for _, opportunity := range flagOpportunities(opportunities, flags) {
+			if err := encoder.Encode(opportunity); err != nil {
+				return err
+			}
+		}
+		return nil
+	case csvOutput:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(fillColumns); err != nil {
+			return err
+		}
+		for i, opportunity := range opportunities {
+			for j, leg := range opportunity.Legs {
+				for _, fill := range leg.Fills {
+					if err := writer.Write(formatFillRow(i, opportunity, j, leg, fill, flags)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case tableOutput:
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.ToUpper(strings.Join(fillColumns, "\t")))
+		for i, opportunity := range opportunities {
+			for j, leg := range opportunity.Legs {
+				for _, fill := range leg.Fills {
+					fmt.Fprintln(writer, strings.Join(formatFillRow(i, opportunity, j, leg, fill, flags), "\t"))
+				}
+			}
+		}
+		return writer.Flush()
+	default:
+		printOpportunities(w, opportunities, flags)
+		return nil
+	}
+}
+
+func formatFillRow(
+	opportunityIndex int,
+	opportunity strategy.Opportunity,
+	legIndex int,
+	leg strategy.Leg,
+	fill strategy.Fill,
+	flags listingFlags,
+) []string {
+	return []string{
+		strconv.Itoa(opportunityIndex + 1),
+		opportunity.StartItem,
+		strconv.FormatFloat(opportunity.GainPercent, 'f', 3, 64),
+		strconv.FormatFloat(opportunity.Profit, 'f', 2, 64),
+		opportunity.ReferenceCurrency,
+		strconv.FormatFloat(opportunity.ProfitValue, 'f', 2, 64),
+		strconv.FormatFloat(opportunity.CapitalValue, 'f', 2, 64),
+		strconv.FormatUint(uint64(opportunity.InputAmount), 10),
+		strconv.FormatUint(uint64(opportunity.OutputAmount), 10),
+		strconv.FormatUint(uint64(opportunity.TradeWindows), 10),
+		strconv.FormatFloat(opportunity.Risk, 'f', 3, 64),
+		strconv.FormatFloat(opportunity.RiskAdjustedGain, 'f', 3, 64),
+		strconv.Itoa(legIndex + 1),
+		strconv.FormatFloat(leg.Ratio, 'f', 3, 64),
+		strconv.FormatUint(uint64(fill.PayAmount), 10),
+		leg.Pair.InitialItem,
+		strconv.FormatUint(uint64(fill.ReceiveAmount), 10),
+		leg.Pair.TargetItem,
+		strconv.FormatUint(uint64(fill.Listing.Stock), 10),
+		strconv.FormatFloat(fill.Listing.Ratio, 'f', 3, 64),
+		strconv.FormatUint(uint64(fill.Rounds), 10),
+		strconv.FormatFloat(fill.FillProbability, 'f', 3, 64),
+		strings.Join(flags.get(leg.Pair, fill.Listing), "|"),
+		fill.Listing.Account,
+		strings.Join(fill.Whispers, "|"),
+	}
+}
+
+func printOpportunities(w io.Writer, opportunities []strategy.Opportunity, flags listingFlags) {
+	if len(opportunities) == 0 {
+		fmt.Fprintln(w, "No profitable trades found.")
+		return
+	}
+
+	for _, opportunity := range opportunities {
+		fmt.Fprintf(w, "%+v\n", opportunity.Path)
+		for _, leg := range opportunity.Legs {
+			for _, fill := range leg.Fills {
+				printFill(w, fill, flags.get(leg.Pair, fill.Listing))
+			}
+			if len(leg.Fills) > 1 {
+				fmt.Fprintf(
+					w,
+					"Leg total: %d %s => %d %s (Ratio: %.3f)\n",
+					leg.PayAmount,
+					leg.Pair.InitialItem,
+					leg.ReceiveAmount,
+					leg.Pair.TargetItem,
+					leg.Ratio,
+				)
+			}
+		}
+		fmt.Fprintf(
+			w,
+			"\nGains: %.3f%% %s (Profit: %.2f %s)\nTrade windows: %d\nRisk: %.1f%% (Risk-adjusted gains: %.3f%%)\n\n",
+			opportunity.GainPercent,
+			opportunity.StartItem,
+			opportunity.Profit,
+			opportunity.StartItem,
+			opportunity.TradeWindows,
+			opportunity.Risk*100,
+			opportunity.RiskAdjustedGain,
+		)
+		if opportunity.ReferenceCurrency != "" {
+			fmt.Fprintf(
+				w,
+				"Value: %.2f %s profit on %.2f %s capital\n\n",
+				opportunity.ProfitValue,
+				opportunity.ReferenceCurrency,
+				opportunity.CapitalValue,
+				opportunity.ReferenceCurrency,
+			)
+		}
+	}
+}
+
+func writePlan(w io.Writer, format string, plan strategy.Plan, flags listingFlags) error {
+	switch format {
+	case jsonOutput:
+		legs := make([]strategy.Leg, 0, len(plan.Steps))
+		for _, step := range plan.Steps {
+			legs = append(legs, step.Legs...)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(flaggedPlan{Plan: plan, Flags: flags.forLegs(legs)})
+	case textOutput:
+		printPlan(w, plan, flags)
+		return nil
+	default:
+		return writeOpportunities(w, format, plan.Steps, flags)
+	}
+}
+
+func printPlan(w io.Writer, plan strategy.Plan, flags listingFlags) {
+	if len(plan.Steps) == 0 {
+		fmt.Fprintln(w, "No profitable trades found.")
+		return
+	}
+
+	for i, step := range plan.Steps {
+		fmt.Fprintf(w, "=== Step %d: %s ===\n", i+1, step.Key())
+		printOpportunities(w, []strategy.Opportunity{step}, flags)
+	}
+
+	fmt.Fprintln(w, "Plan total:")
+	for _, item := range sortedKeys(plan.Profit) {
+		fmt.Fprintf(w, "  %+d %s\n", plan.Profit[item], item)
+	}
+	if plan.ReferenceCurrency != "" {
+		fmt.Fprintf(w, "  Value: %.2f %s\n", plan.ProfitValue, plan.ReferenceCurrency)
+	}
+	fmt.Fprintln(w, "Remaining capital:")
+	for _, item := range sortedKeys(plan.RemainingCapital) {
+		fmt.Fprintf(w, "  %d %s\n", plan.RemainingCapital[item], item)
+	}
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func printFill(w io.Writer, fill strategy.Fill, flags []string) {
+	for _, whisper := range fill.Whispers {
+		fmt.Fprintln(w, whisper)
+	}
+	printTradeDetail(w, fill.Listing, flags)
+	if fill.Rounds > 1 {
+		fmt.Fprintf(w, "Rounds: %d (split to fit the inventory)\n", fill.Rounds)
+	}
+}
+
+func printTradeDetail(w io.Writer, tradeDetail api.TradeDetail, flags []string) {
+	fmt.Fprintln(w, "Pay:", tradeDetail.PriceAmount, tradeDetail.PriceUnit)
+	fmt.Fprintln(w, "Receive:", tradeDetail.ItemAmount, tradeDetail.ItemUnit)
+	fmt.Fprintln(w, "Stock:", tradeDetail.Stock)
+	fmt.Fprintf(w, "Ratio: %.3f\n", tradeDetail.Ratio)
+	if len(flags) > 0 {
+		fmt.Fprintln(w, "Flags:", strings.Join(flags, ", "))
+	}
+}
+
+// writeRows writes rows as csv or as a table, emptyMsg replaces an empty table
+func writeRows(w io.Writer, format string, columns []string, rows [][]string, emptyMsg string) error {
+	if format == csvOutput {
+		writer := csv.NewWriter(w)
+		if err := writer.Write(columns); err != nil {
+			return err
+		}
+		if err := writer.WriteAll(rows); err != nil {
+			return err
+		}
+		return writer.Error()
+	}
+
+	if len(rows) == 0 {
+		fmt.Fprintln(w, emptyMsg)
+		return nil
+	}
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.ToUpper(strings.Join(columns, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteRows(t *testing.T) {
+	columns := []string{"path", "pnl"}
+	rows := [][]string{{"chaos>exalted>chaos", "12.50"}, {"chaos>gcp>chaos", "-3.00"}}
+
+	tests := []struct {
+		name   string
+		format string
+		rows   [][]string
+		want   string
+	}{
+		{"csv", csvOutput, rows, "path,pnl\nchaos>exalted>chaos,12.50\nchaos>gcp>chaos,-3.00\n"},
+		{"empty csv", csvOutput, nil, "path,pnl\n"},
+		{"table", tableOutput, rows, "PATH                 PNL\nchaos>exalted>chaos  12.50\nchaos>gcp>chaos      -3.00\n"},
+		{"empty table", tableOutput, nil, "Nothing recorded.\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output strings.Builder
+			if err := writeRows(&output, tt.format, columns, tt.rows, "Nothing recorded."); err != nil {
+				t.Fatal(err)
+			}
+			if output.String() != tt.want {
+				t.Errorf("writeRows() = %q, want %q", output.String(), tt.want)
+			}
+		})
+	}
+}
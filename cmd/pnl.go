@@ -0,0 +1,661 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/journal"
+	"github.com/t73liu/poe-arbitrage/strategy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Order books recorded this long before the first trade are used to value it
+const valuationLookback = 24 * time.Hour
+
+var journalAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Record an executed trading path",
+	Long: `
+Record the amounts actually paid and received in every leg of an executed
+trading path, e.g.
+
+  poe-arbitrage journal add --leg "1500 chaos > 10 exalted" --leg "10 exalted > 1530 chaos"
+
+Pass the output of "trade -o json" with --suggestion to link the trade to the
+suggested opportunity with the same path and record its gains and profit,
+e.g.
+
+  poe-arbitrage trade chaos exalted -o json > suggestions.json
+  poe-arbitrage journal add --suggestion suggestions.json --leg "1500 chaos > 10 exalted" --leg "10 exalted > 1530 chaos"
+
+Otherwise pass the gains and profit printed by trade with
+--predicted-gain-percent and --predicted-profit to compare them in journal
+list and report.
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var config Config
+		if err := viper.Unmarshal(&config); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse config:", err)
+			return err
+		}
+
+		legFlags, err := cmd.Flags().GetStringArray("leg")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --leg:", err)
+			return err
+		}
+		trade := journal.Trade{
+			Time: time.Now(),
+			Legs: make([]journal.TradeLeg, 0, len(legFlags)),
+		}
+		for i, legFlag := range legFlags {
+			leg, err := parseTradeLeg(legFlag)
+			if err != nil {
+				return fmt.Errorf("invalid --leg %q: %w", legFlag, err)
+			}
+			if i > 0 && leg.Have != trade.Legs[i-1].Want {
+				return fmt.Errorf("invalid --leg %q: must pay with %s received in the previous leg", legFlag, trade.Legs[i-1].Want)
+			}
+			trade.Legs = append(trade.Legs, leg)
+		}
+
+		timeFlag, err := cmd.Flags().GetString("time")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --time:", err)
+			return err
+		}
+		if strings.TrimSpace(timeFlag) != "" {
+			if trade.Time, err = parseTime(timeFlag); err != nil {
+				return fmt.Errorf("invalid --time: %w", err)
+			}
+		}
+
+		suggestionFile, err := cmd.Flags().GetString("suggestion")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --suggestion:", err)
+			return err
+		}
+		if strings.TrimSpace(suggestionFile) != "" {
+			if cmd.Flags().Changed("predicted-gain-percent") || cmd.Flags().Changed("predicted-profit") {
+				return errors.New("--suggestion cannot be combined with --predicted-gain-percent or --predicted-profit")
+			}
+			suggestions, err := readSuggestions(suggestionFile)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Unable to read --suggestion:", err)
+				return err
+			}
+			opportunity, ok := findSuggestion(suggestions, trade.Key())
+			if !ok {
+				return fmt.Errorf("no suggested opportunity trades %s", trade.Key())
+			}
+			predictedGainPercent, predictedProfit := opportunity.GainPercent, opportunity.Profit
+			trade.Suggestion = opportunity.Key()
+			trade.PredictedGainPercent = &predictedGainPercent
+			trade.PredictedProfit = &predictedProfit
+		}
+
+		if cmd.Flags().Changed("predicted-gain-percent") {
+			predictedGainPercent, err := cmd.Flags().GetFloat64("predicted-gain-percent")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to parse --predicted-gain-percent:", err)
+				return err
+			}
+			trade.PredictedGainPercent = &predictedGainPercent
+		}
+		if cmd.Flags().Changed("predicted-profit") {
+			predictedProfit, err := cmd.Flags().GetFloat64("predicted-profit")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to parse --predicted-profit:", err)
+				return err
+			}
+			trade.PredictedProfit = &predictedProfit
+		}
+
+		if trade.Note, err = cmd.Flags().GetString("note"); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --note:", err)
+			return err
+		}
+
+		journalStore, err := openRequiredJournal(cmd, config)
+		if err != nil {
+			return err
+		}
+		defer journalStore.Close()
+
+		trade, err = journalStore.AddTrade(trade)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to record trade:", err)
+			return err
+		}
+		if gainPercent, ok := trade.GainPercent(); ok {
+			fmt.Printf("Recorded trade #%d %s (Gains: %.3f%% %s)\n", trade.ID, trade.Key(), gainPercent, trade.StartItem())
+		} else {
+			fmt.Printf("Recorded trade #%d %s\n", trade.ID, trade.Key())
+		}
+		return nil
+	},
+}
+
+var journalListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the recorded trades with their realized and predicted gains",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var config Config
+		if err := viper.Unmarshal(&config); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse config:", err)
+			return err
+		}
+
+		from, to, err := parseTimeRange(cmd, 0)
+		if err != nil {
+			return err
+		}
+
+		outputFormat, err := parseJournalOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		journalStore, err := openRequiredJournal(cmd, config)
+		if err != nil {
+			return err
+		}
+		defer journalStore.Close()
+
+		trades, err := journalStore.Trades(from, to)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to read journal:", err)
+			return err
+		}
+		return writeTrades(os.Stdout, outputFormat, trades)
+	},
+}
+
+var journalReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report the realized PnL per item and per day in a reference currency",
+	Long: `
+Value the recorded trades in the reference currency using the mid-market of
+the last order books recorded in the history file before every trade, and
+compare the realized PnL with the profit predicted when the trade was added.
+Trades without a prediction are left out of the comparison and trades without
+an order book recorded before them are not valued.
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var config Config
+		if err := viper.Unmarshal(&config); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse config:", err)
+			return err
+		}
+
+		reference, err := cmd.Flags().GetString("reference")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --reference:", err)
+			return err
+		}
+		reference = strings.TrimSpace(reference)
+		if reference == "" {
+			reference = config.ReferenceCurrency
+		}
+		if reference == "" {
+			return errors.New("no reference currency configured, use --reference or set referenceCurrency in the config")
+		}
+		if err := validateItems([]string{reference}, "Invalid --reference"); err != nil {
+			return err
+		}
+
+		from, to, err := parseTimeRange(cmd, 0)
+		if err != nil {
+			return err
+		}
+
+		outputFormat, err := parseJournalOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		journalStore, err := openRequiredJournal(cmd, config)
+		if err != nil {
+			return err
+		}
+		defer journalStore.Close()
+
+		trades, err := journalStore.Trades(from, to)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to read journal:", err)
+			return err
+		}
+
+		historyFile, err := cmd.Flags().GetString("history")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --history:", err)
+			return err
+		}
+		historyStore, err := openHistory(historyFile, config)
+		if err != nil {
+			return err
+		}
+		if historyStore == nil {
+			return errors.New("no history file configured, use --history or set historyFile in the config")
+		}
+		defer historyStore.Close()
+
+		historyFrom := from
+		if len(trades) > 0 {
+			historyFrom = trades[0].Time.Add(-valuationLookback)
+		}
+		records, err := historyStore.Query(getLeague(config), historyFrom, to)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to query history:", err)
+			return err
+		}
+		snapshots, err := buildSnapshots(records, nil, nil, strategy.Options{})
+		if err != nil {
+			return err
+		}
+
+		report := buildPnLReport(trades, snapshots, reference)
+		return writePnLReport(os.Stdout, outputFormat, report)
+	},
+}
+
+func init() {
+	journalCmd.AddCommand(journalAddCmd)
+	journalCmd.AddCommand(journalListCmd)
+	journalCmd.AddCommand(journalReportCmd)
+
+	journalAddCmd.Flags().StringArray(
+		"leg",
+		nil,
+		"Amounts paid and received in a leg, repeated for every leg in order (i.e. \"1500 chaos > 10 exalted\")",
+	)
+	journalAddCmd.MarkFlagRequired("leg")
+
+	journalAddCmd.Flags().String(
+		"time",
+		"",
+		"Time the trade was executed, RFC3339 or YYYY-MM-DD (default is now)",
+	)
+
+	journalAddCmd.Flags().String(
+		"suggestion",
+		"",
+		"JSON output of trade (- for stdin) containing the executed opportunity, records its gains and profit",
+	)
+
+	journalAddCmd.Flags().Float64(
+		"predicted-gain-percent",
+		0,
+		"Gains reported by trade when the path was suggested",
+	)
+
+	journalAddCmd.Flags().Float64(
+		"predicted-profit",
+		0,
+		"Profit (in the starting item) reported by trade when the path was suggested",
+	)
+
+	journalAddCmd.Flags().String(
+		"note",
+		"",
+		"Free-form note",
+	)
+
+	for _, cmd := range []*cobra.Command{journalListCmd, journalReportCmd} {
+		addTimeRangeFlags(cmd, 0)
+		cmd.Flags().StringP(
+			"output",
+			"o",
+			tableOutput,
+			"Output format (table or json)",
+		)
+	}
+
+	journalReportCmd.Flags().String(
+		"reference",
+		"",
+		"Value the PnL in this item (default is referenceCurrency in the config)",
+	)
+
+	journalReportCmd.Flags().String(
+		"history",
+		"",
+		"History file used to value items (default is historyFile in the config)",
+	)
+}
+
+func parseJournalOutputFormat(cmd *cobra.Command) (string, error) {
+	outputFormat, err := cmd.Flags().GetString("output")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --output:", err)
+		return "", err
+	}
+	outputFormat, err = parseOutputFormat(outputFormat)
+	if err != nil {
+		return "", err
+	}
+	if outputFormat != tableOutput && outputFormat != jsonOutput {
+		return "", fmt.Errorf("%s does not support %s output", cmd.CommandPath(), outputFormat)
+	}
+	return outputFormat, nil
+}
+
+// parseTradeLeg parses "PAID HAVE > RECEIVED WANT" (i.e. "1500 chaos > 10 exalted")
+func parseTradeLeg(value string) (journal.TradeLeg, error) {
+	sides := strings.Split(value, ">")
+	if len(sides) != 2 {
+		return journal.TradeLeg{}, errors.New(`expected "PAID HAVE > RECEIVED WANT"`)
+	}
+	paid, have, err := parseItemAmount(sides[0])
+	if err != nil {
+		return journal.TradeLeg{}, err
+	}
+	received, want, err := parseItemAmount(sides[1])
+	if err != nil {
+		return journal.TradeLeg{}, err
+	}
+	if have == want {
+		return journal.TradeLeg{}, errors.New("cannot trade an item for itself")
+	}
+	if err := validateItems([]string{have, want}, "invalid item"); err != nil {
+		return journal.TradeLeg{}, err
+	}
+	return journal.TradeLeg{
+		Have:     have,
+		Paid:     paid,
+		Want:     want,
+		Received: received,
+	}, nil
+}
+
+func parseItemAmount(value string) (uint, string, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return 0, "", fmt.Errorf("expected an amount and an item, got %q", strings.TrimSpace(value))
+	}
+	amount, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil || amount == 0 {
+		return 0, "", fmt.Errorf("invalid amount %q", fields[0])
+	}
+	return uint(amount), fields[1], nil
+}
+
+// readSuggestions reads opportunities written by trade -o json or ndjson
+func readSuggestions(file string) ([]strategy.Opportunity, error) {
+	if file == "-" {
+		return parseSuggestions(os.Stdin)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseSuggestions(f)
+}
+
+func parseSuggestions(r io.Reader) ([]strategy.Opportunity, error) {
+	suggestions := make([]strategy.Opportunity, 0)
+	decoder := json.NewDecoder(r)
+	for {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err == io.EOF {
+			return suggestions, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if trimmed := bytes.TrimSpace(value); len(trimmed) > 0 && trimmed[0] == '[' {
+			var opportunities []strategy.Opportunity
+			if err := json.Unmarshal(value, &opportunities); err != nil {
+				return nil, err
+			}
+			suggestions = append(suggestions, opportunities...)
+			continue
+		}
+		var opportunity strategy.Opportunity
+		if err := json.Unmarshal(value, &opportunity); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, opportunity)
+	}
+}
+
+// findSuggestion returns the first (best) suggestion trading the path key
+func findSuggestion(suggestions []strategy.Opportunity, key string) (strategy.Opportunity, bool) {
+	for _, suggestion := range suggestions {
+		if suggestion.Key() == key {
+			return suggestion, true
+		}
+	}
+	return strategy.Opportunity{}, false
+}
+
+func writeTrades(w io.Writer, format string, trades []journal.Trade) error {
+	if format == jsonOutput {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(trades)
+	}
+
+	if len(trades) == 0 {
+		fmt.Fprintln(w, "No trades recorded.")
+		return nil
+	}
+	columns := []string{"id", "time", "path", "paid", "received", "gainPercent", "predictedGainPercent", "note"}
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.ToUpper(strings.Join(columns, "\t")))
+	for _, trade := range trades {
+		firstLeg := trade.Legs[0]
+		lastLeg := trade.Legs[len(trade.Legs)-1]
+		gainPercent := ""
+		if value, ok := trade.GainPercent(); ok {
+			gainPercent = strconv.FormatFloat(value, 'f', 3, 64)
+		}
+		predictedGainPercent := ""
+		if trade.PredictedGainPercent != nil {
+			predictedGainPercent = strconv.FormatFloat(*trade.PredictedGainPercent, 'f', 3, 64)
+		}
+		fmt.Fprintln(writer, strings.Join([]string{
+			strconv.FormatUint(trade.ID, 10),
+			trade.Time.Format(time.RFC3339),
+			trade.Key(),
+			fmt.Sprintf("%d %s", firstLeg.Paid, firstLeg.Have),
+			fmt.Sprintf("%d %s", lastLeg.Received, lastLeg.Want),
+			gainPercent,
+			predictedGainPercent,
+			trade.Note,
+		}, "\t"))
+	}
+	return writer.Flush()
+}
+
+type pnlReport struct {
+	ReferenceCurrency string `json:"referenceCurrency"`
+	pnlSummary
+	Days  []dayPnL  `json:"days"`
+	Items []itemPnL `json:"items"`
+	// Trades without an order book recorded before them or with an item that
+	// those order books cannot value
+	Unvalued []uint64 `json:"unvalued,omitempty"`
+}
+
+type pnlSummary struct {
+	Trades   int     `json:"trades"`
+	Realized float64 `json:"realized"`
+	// Predicted and realized PnL of the trades with a prediction
+	Predicted         float64 `json:"predicted"`
+	RealizedPredicted float64 `json:"realizedPredicted"`
+	// Trades without a prediction, left out of Predicted
+	Unpredicted int `json:"unpredicted"`
+}
+
+// Difference between the realized and predicted PnL of the trades with a
+// prediction
+func (s pnlSummary) Difference() float64 {
+	return s.RealizedPredicted - s.Predicted
+}
+
+type dayPnL struct {
+	Day string `json:"day"`
+	pnlSummary
+}
+
+type itemPnL struct {
+	Item string `json:"item"`
+	// Net amount gained (or lost)
+	Amount int     `json:"amount"`
+	Value  float64 `json:"value"`
+}
+
+// buildPnLReport values every trade with the last snapshot at or before the
+// trade, trades without one are unvalued
+func buildPnLReport(trades []journal.Trade, snapshots []strategy.Snapshot, reference string) pnlReport {
+	report := pnlReport{
+		ReferenceCurrency: reference,
+		Days:              make([]dayPnL, 0),
+		Items:             make([]itemPnL, 0),
+	}
+	valuations := make(map[int]map[string]float64)
+	items := make(map[string]*itemPnL)
+	for _, trade := range trades {
+		snapshotIndex := sort.Search(len(snapshots), func(i int) bool {
+			return snapshots[i].Time.After(trade.Time)
+		}) - 1
+		if snapshotIndex < 0 {
+			report.Unvalued = append(report.Unvalued, trade.ID)
+			continue
+		}
+		if _, ok := valuations[snapshotIndex]; !ok {
+			valuations[snapshotIndex] = snapshots[snapshotIndex].TradingPaths.Valuations(reference)
+		}
+		summary, ok := valueTrade(trade, valuations[snapshotIndex])
+		if !ok {
+			report.Unvalued = append(report.Unvalued, trade.ID)
+			continue
+		}
+
+		for item, amount := range trade.Profit() {
+			if _, ok := items[item]; !ok {
+				items[item] = &itemPnL{Item: item}
+			}
+			items[item].Amount += amount
+			items[item].Value += float64(amount) * valuations[snapshotIndex][item]
+		}
+
+		day := trade.Time.Local().Format("2006-01-02")
+		if last := len(report.Days) - 1; last < 0 || report.Days[last].Day != day {
+			report.Days = append(report.Days, dayPnL{Day: day})
+		}
+		report.Days[len(report.Days)-1].add(summary)
+		report.add(summary)
+	}
+
+	for _, item := range items {
+		report.Items = append(report.Items, *item)
+	}
+	sort.Slice(report.Items, func(i, j int) bool {
+		return report.Items[i].Item < report.Items[j].Item
+	})
+	return report
+}
+
+// valueTrade returns the realized and predicted PnL of the trade in the
+// reference currency, false if an item cannot be valued
+func valueTrade(trade journal.Trade, valuations map[string]float64) (pnlSummary, bool) {
+	summary := pnlSummary{Trades: 1}
+	for item, amount := range trade.Profit() {
+		value, ok := valuations[item]
+		if !ok {
+			return pnlSummary{}, false
+		}
+		summary.Realized += float64(amount) * value
+	}
+	if trade.PredictedProfit == nil {
+		summary.Unpredicted = 1
+		return summary, true
+	}
+	value, ok := valuations[trade.StartItem()]
+	if !ok {
+		return pnlSummary{}, false
+	}
+	summary.Predicted = *trade.PredictedProfit * value
+	summary.RealizedPredicted = summary.Realized
+	return summary, true
+}
+
+func (s *pnlSummary) add(other pnlSummary) {
+	s.Trades += other.Trades
+	s.Realized += other.Realized
+	s.Predicted += other.Predicted
+	s.RealizedPredicted += other.RealizedPredicted
+	s.Unpredicted += other.Unpredicted
+}
+
+func writePnLReport(w io.Writer, format string, report pnlReport) error {
+	if format == jsonOutput {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	if report.Trades == 0 && len(report.Unvalued) == 0 {
+		fmt.Fprintln(w, "No trades recorded.")
+		return nil
+	}
+	formatValue := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', 2, 64)
+	}
+
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "DAY\tTRADES\tREALIZED\tPREDICTED\tDIFFERENCE\tUNPREDICTED")
+	for _, day := range append(report.Days, dayPnL{Day: "total", pnlSummary: report.pnlSummary}) {
+		fmt.Fprintln(writer, strings.Join([]string{
+			day.Day,
+			strconv.Itoa(day.Trades),
+			formatValue(day.Realized),
+			formatValue(day.Predicted),
+			formatValue(day.Difference()),
+			strconv.Itoa(day.Unpredicted),
+		}, "\t"))
+	}
+	fmt.Fprintln(writer)
+	fmt.Fprintln(writer, "ITEM\tAMOUNT\tVALUE")
+	for _, item := range report.Items {
+		fmt.Fprintf(writer, "%s\t%d\t%s\n", item.Item, item.Amount, formatValue(item.Value))
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nValues are in %s", report.ReferenceCurrency)
+	if len(report.Unvalued) > 0 {
+		ids := make([]string, 0, len(report.Unvalued))
+		for _, id := range report.Unvalued {
+			ids = append(ids, "#"+strconv.FormatUint(id, 10))
+		}
+		fmt.Fprintf(
+			w,
+			", trades %s are excluded since the order books recorded before them cannot value every traded item",
+			strings.Join(ids, ", "),
+		)
+	}
+	fmt.Fprintln(w, ".")
+	if report.Unpredicted > 0 {
+		fmt.Fprintf(w, "%d trades without a prediction are excluded from PREDICTED and DIFFERENCE.\n", report.Unpredicted)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/journal"
+	"github.com/t73liu/poe-arbitrage/strategy"
+)
+
+func chaosTrade(id uint64, tradeTime time.Time, paid, received uint, predictedProfit *float64) journal.Trade {
+	return journal.Trade{
+		ID:   id,
+		Time: tradeTime,
+		Legs: []journal.TradeLeg{
+			{Have: "chaos", Paid: paid, Want: "exalted", Received: 10},
+			{Have: "exalted", Paid: 10, Want: "chaos", Received: received},
+		},
+		PredictedProfit: predictedProfit,
+	}
+}
+
+func TestBuildPnLReport(t *testing.T) {
+	snapshotTime := time.Date(2022, 8, 1, 12, 0, 0, 0, time.Local)
+	tradingPaths := strategy.NewTradingPaths(nil, strategy.Options{})
+	listings := []api.TradeDetail{tradeDetail("ec", "seller", 1, 150, 10)}
+	if err := tradingPaths.Set("exalted", "chaos", &listings); err != nil {
+		t.Fatal(err)
+	}
+	snapshots := []strategy.Snapshot{{Time: snapshotTime, TradingPaths: tradingPaths}}
+
+	predictedProfit := 45.0
+	trades := []journal.Trade{
+		// Only order books recorded after the trade
+		chaosTrade(1, snapshotTime.Add(-time.Hour), 1500, 1600, &predictedProfit),
+		chaosTrade(2, snapshotTime.Add(time.Hour), 1500, 1530, &predictedProfit),
+		chaosTrade(3, snapshotTime.Add(2*time.Hour), 1500, 1520, nil),
+		// gcp has no recorded order book
+		{
+			ID:   4,
+			Time: snapshotTime.Add(3 * time.Hour),
+			Legs: []journal.TradeLeg{{Have: "chaos", Paid: 100, Want: "gcp", Received: 110}},
+		},
+	}
+
+	report := buildPnLReport(trades, snapshots, "chaos")
+	if !reflect.DeepEqual(report.Unvalued, []uint64{1, 4}) {
+		t.Errorf("Unvalued = %v, want [1 4]", report.Unvalued)
+	}
+	want := pnlSummary{Trades: 2, Realized: 50, Predicted: 45, RealizedPredicted: 30, Unpredicted: 1}
+	if report.pnlSummary != want {
+		t.Errorf("pnlSummary = %+v, want %+v", report.pnlSummary, want)
+	}
+	if difference := report.Difference(); math.Abs(difference+15) > 1e-9 {
+		t.Errorf("Difference() = %f, want -15", difference)
+	}
+	wantItems := []itemPnL{{Item: "chaos", Amount: 50, Value: 50}}
+	if !reflect.DeepEqual(report.Items, wantItems) {
+		t.Errorf("Items = %+v, want %+v", report.Items, wantItems)
+	}
+
+	var output strings.Builder
+	if err := writePnLReport(&output, tableOutput, report); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"trades #1, #4 are excluded since the order books recorded before them cannot value every traded item",
+		"1 trades without a prediction are excluded",
+	} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("writePnLReport() = %q, want it to contain %q", output.String(), want)
+		}
+	}
+}
+
+func TestParseSuggestions(t *testing.T) {
+	chaosExalted := `{"startItem":"chaos","path":[{"initialItem":"chaos","targetItem":"exalted"},{"initialItem":"exalted","targetItem":"chaos"}],"gainPercent":2,"profit":30}`
+	chaosGCP := `{"startItem":"chaos","path":[{"initialItem":"chaos","targetItem":"gcp"},{"initialItem":"gcp","targetItem":"chaos"}],"gainPercent":1,"profit":10,"flags":{"gc1":["outlier"]}}`
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"json", "[" + chaosGCP + ",\n" + chaosExalted + "]\n"},
+		{"ndjson", chaosGCP + "\n" + chaosExalted + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suggestions, err := parseSuggestions(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(suggestions) != 2 {
+				t.Fatalf("parseSuggestions() returned %d opportunities, want 2", len(suggestions))
+			}
+
+			opportunity, ok := findSuggestion(suggestions, "chaos>exalted>chaos")
+			if !ok {
+				t.Fatal("findSuggestion() did not find chaos>exalted>chaos")
+			}
+			if opportunity.GainPercent != 2 || opportunity.Profit != 30 {
+				t.Errorf("findSuggestion() = %+v", opportunity)
+			}
+			if _, ok := findSuggestion(suggestions, "exalted>chaos>exalted"); ok {
+				t.Error("findSuggestion() matched a path that was not suggested")
+			}
+		})
+	}
+
+	if _, err := parseSuggestions(strings.NewReader("not json")); err == nil {
+		t.Error("parseSuggestions() accepted invalid JSON")
+	}
+}
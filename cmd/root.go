@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"time"
@@ -17,6 +19,13 @@ import (
 
 const initialConfig = "https://raw.githubusercontent.com/t73liu/poe-arbitrage/master/default-config.json"
 const defaultConfigFileName = "poe-arbitrage.json"
+const defaultHistoryRetentionDays = 30
+const defaultMinGainPercent = 1.0
+
+const defaultAutoIgnoreFailures = 3
+
+// Main inventory is 12 x 5 slots
+const defaultInventorySlots = 60
 
 var customConfigFile string
 
@@ -40,19 +49,41 @@ type BulkItem struct {
 }
 
 type Config struct {
+	BaseURL         string              `json:"baseURL,omitempty"`
 	League          string              `json:"league"`
 	Hardcore        bool                `json:"hardcore"`
 	ExcludeAFK      bool                `json:"excludeAFK"`
 	IgnoredPlayers  []string            `json:"ignoredPlayers"`
 	FavoritePlayers []string            `json:"favoritePlayers"`
 	BulkItems       map[string]BulkItem `json:"bulkItems"`
+	// Order book history is only recorded if a file is provided
+	HistoryFile          string `json:"historyFile,omitempty"`
+	HistoryRetentionDays int    `json:"historyRetentionDays,omitempty"`
+	// Thresholds of reported trading paths, see the strategy flags
+	MinGainPercent float64 `json:"minGainPercent"`
+	MinGain        float64 `json:"minGain,omitempty"`
+	LegFriction    string  `json:"legFriction,omitempty"`
+	// Opportunities are valued and ranked in this item if set
+	ReferenceCurrency string `json:"referenceCurrency,omitempty"`
+	// Whisper outcomes are only tracked if a file is provided
+	JournalFile string `json:"journalFile,omitempty"`
+	// Accounts are ignored after this many consecutive ignored or failed
+	// whispers, disabled if 0
+	AutoIgnoreFailures int `json:"autoIgnoreFailures"`
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// SIGINT cancels the command context, a second SIGINT exits immediately.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
@@ -78,19 +109,22 @@ func initConfig() {
 func initConfigE() error {
 	viper.AutomaticEnv()
 	viper.SetConfigType("json")
+	viper.SetDefault("historyRetentionDays", defaultHistoryRetentionDays)
+	viper.SetDefault("minGainPercent", defaultMinGainPercent)
+	viper.SetDefault("autoIgnoreFailures", defaultAutoIgnoreFailures)
 
 	customConfigFile = strings.TrimSpace(customConfigFile)
 
 	if customConfigFile != "" {
 		viper.SetConfigFile(customConfigFile)
 		if err := viper.ReadInConfig(); err != nil {
-			fmt.Println("Could not open config file:", err)
+			fmt.Fprintln(os.Stderr, "Could not open config file:", err)
 			return err
 		}
 	} else {
 		home, err := homedir.Dir()
 		if err != nil {
-			fmt.Println("Failed to detect home directory:", err)
+			fmt.Fprintln(os.Stderr, "Failed to detect home directory:", err)
 			return err
 		}
 
@@ -99,11 +133,11 @@ func initConfigE() error {
 
 		if utils.FileExists(defaultConfigFilePath) {
 			if err := viper.ReadInConfig(); err != nil {
-				fmt.Println("Could not open config file:", err)
+				fmt.Fprintln(os.Stderr, "Could not open config file:", err)
 				return err
 			}
 		} else {
-			fmt.Println("Initializing default config file:", defaultConfigFilePath)
+			fmt.Fprintln(os.Stderr, "Initializing default config file:", defaultConfigFilePath)
 			client := http.Client{
 				Timeout: 10 * time.Second,
 				Transport: &http.Transport{
@@ -113,7 +147,7 @@ func initConfigE() error {
 
 			resp, err := client.Get(initialConfig)
 			if err != nil {
-				fmt.Println("Unable to download default config:", err)
+				fmt.Fprintln(os.Stderr, "Unable to download default config:", err)
 				return err
 			}
 			defer resp.Body.Close()
@@ -123,16 +157,17 @@ func initConfigE() error {
 			}
 
 			if err := viper.ReadConfig(resp.Body); err != nil {
-				fmt.Println("Unable to read the default config:", err)
+				fmt.Fprintln(os.Stderr, "Unable to read the default config:", err)
 				return err
 			}
 
 			if err := viper.WriteConfig(); err != nil {
-				fmt.Println("Unable to create default config:", err)
+				fmt.Fprintln(os.Stderr, "Unable to create default config:", err)
 				return err
 			}
 		}
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		// Written to stderr to keep machine-readable output intact
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 
 	return nil
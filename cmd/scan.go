@@ -0,0 +1,579 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/strategy"
+	"github.com/t73liu/poe-arbitrage/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// validateScanArgs validates the items and --capital of commands that scan
+// the exchange (e.g. trade, serve)
+func validateScanArgs(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return errors.New("provide at least 2 items")
+	}
+
+	if err := validateItems(args, "Invalid arguments: "); err != nil {
+		return err
+	}
+
+	initialCapital, err := cmd.Flags().GetStringToInt("capital")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not parse --capital argument:", err)
+		return err
+	}
+
+	capitalItems := make([]string, 0, len(initialCapital))
+	for item := range initialCapital {
+		capitalItems = append(capitalItems, item)
+	}
+
+	if err := validateItems(capitalItems, "Invalid capital: "); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// addStrategyFlags registers the flags read by parseStrategyOptions
+func addStrategyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringToIntP(
+		"capital",
+		"c",
+		make(map[string]int),
+		"Specify starting capital (i.e. chaos=40,exa=1).",
+	)
+
+	cmd.Flags().String(
+		"algorithm",
+		string(strategy.DFS),
+		"Cycle search algorithm (dfs or bellman-ford). Use bellman-ford for many items",
+	)
+
+	cmd.Flags().Float64(
+		"max-slippage",
+		0.5,
+		"Fill a trade across listings priced up to this percentage worse than the best listing",
+	)
+
+	cmd.Flags().Float64(
+		"min-gain-percent",
+		defaultMinGainPercent,
+		"Only report paths gaining more than this percentage (overrides minGainPercent in the config)",
+	)
+
+	cmd.Flags().Float64(
+		"min-gain",
+		0,
+		"Only report paths gaining at least this amount of the starting item (overrides minGain in the config)",
+	)
+
+	cmd.Flags().String(
+		"leg-friction",
+		"",
+		"Cost of every leg as a percentage (e.g. 0.5%) or flat amount of the starting item (overrides legFriction in the config)",
+	)
+
+	cmd.Flags().String(
+		"reference",
+		"",
+		"Value and rank opportunities in this item (overrides referenceCurrency in the config)",
+	)
+
+	cmd.Flags().Int(
+		"max-legs",
+		0,
+		"Max number of trades in a path (default is unlimited)",
+	)
+
+	cmd.Flags().StringSlice(
+		"must-include",
+		nil,
+		"Only report paths trading all of these items (i.e. chaos,exa)",
+	)
+
+	cmd.Flags().StringSlice(
+		"exclude-item",
+		nil,
+		"Never trade these items (i.e. mirror)",
+	)
+
+	cmd.Flags().Int(
+		"inventory-slots",
+		defaultInventorySlots,
+		"Inventory slots per trade, larger trades are split into rounds based on the item stack sizes (0 is unlimited)",
+	)
+
+	cmd.Flags().Bool(
+		"risk-adjusted",
+		false,
+		"Rank opportunities by return weighted by the probability of completing every trade",
+	)
+}
+
+// Min value of --max-legs (other than 0 for unlimited), a cycle needs at
+// least 2 trades while a route can be a single trade
+const (
+	cycleMinLegs = 2
+	routeMinLegs = 1
+)
+
+// parseStrategyOptions builds the strategy options from addStrategyFlags,
+// thresholds fall back to the config unless the flag is provided
+func parseStrategyOptions(cmd *cobra.Command, config Config, minLegs int) (strategy.Options, error) {
+	algorithmFlag, err := cmd.Flags().GetString("algorithm")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --algorithm:", err)
+		return strategy.Options{}, err
+	}
+	algorithm, err := strategy.ParseAlgorithm(algorithmFlag)
+	if err != nil {
+		return strategy.Options{}, err
+	}
+	maxSlippage, err := cmd.Flags().GetFloat64("max-slippage")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --max-slippage:", err)
+		return strategy.Options{}, err
+	}
+	if maxSlippage < 0 || maxSlippage >= 100 {
+		return strategy.Options{}, errors.New("--max-slippage must be between 0 and 100")
+	}
+
+	minGainPercent := config.MinGainPercent
+	if cmd.Flags().Changed("min-gain-percent") {
+		if minGainPercent, err = cmd.Flags().GetFloat64("min-gain-percent"); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --min-gain-percent:", err)
+			return strategy.Options{}, err
+		}
+	}
+
+	minGain := config.MinGain
+	if cmd.Flags().Changed("min-gain") {
+		if minGain, err = cmd.Flags().GetFloat64("min-gain"); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --min-gain:", err)
+			return strategy.Options{}, err
+		}
+	}
+	if minGain < 0 {
+		return strategy.Options{}, errors.New("--min-gain cannot be negative")
+	}
+
+	legFrictionFlag := config.LegFriction
+	if cmd.Flags().Changed("leg-friction") {
+		if legFrictionFlag, err = cmd.Flags().GetString("leg-friction"); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --leg-friction:", err)
+			return strategy.Options{}, err
+		}
+	}
+	legFriction, err := strategy.ParseFriction(legFrictionFlag)
+	if err != nil {
+		return strategy.Options{}, err
+	}
+
+	referenceCurrency := config.ReferenceCurrency
+	if cmd.Flags().Changed("reference") {
+		if referenceCurrency, err = cmd.Flags().GetString("reference"); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --reference:", err)
+			return strategy.Options{}, err
+		}
+	}
+	referenceCurrency = strings.TrimSpace(referenceCurrency)
+	if referenceCurrency != "" {
+		if err := validateItems([]string{referenceCurrency}, "Invalid reference currency: "); err != nil {
+			return strategy.Options{}, err
+		}
+	}
+
+	maxLegs, err := cmd.Flags().GetInt("max-legs")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --max-legs:", err)
+		return strategy.Options{}, err
+	}
+	if maxLegs < 0 || (maxLegs > 0 && maxLegs < minLegs) {
+		return strategy.Options{}, fmt.Errorf("--max-legs must be at least %d (0 is unlimited)", minLegs)
+	}
+
+	mustInclude, err := cmd.Flags().GetStringSlice("must-include")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --must-include:", err)
+		return strategy.Options{}, err
+	}
+	if err := validateItems(mustInclude, "Invalid --must-include"); err != nil {
+		return strategy.Options{}, err
+	}
+	if maxLegs > 0 && len(mustInclude) > maxLegs {
+		return strategy.Options{}, errors.New("--must-include has more items than --max-legs allows")
+	}
+
+	excludeItems, err := cmd.Flags().GetStringSlice("exclude-item")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --exclude-item:", err)
+		return strategy.Options{}, err
+	}
+	if err := validateItems(excludeItems, "Invalid --exclude-item"); err != nil {
+		return strategy.Options{}, err
+	}
+	for _, item := range mustInclude {
+		if utils.Contains(excludeItems, item) {
+			return strategy.Options{}, fmt.Errorf("%s cannot be both included and excluded", item)
+		}
+	}
+
+	inventorySlots, err := cmd.Flags().GetInt("inventory-slots")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --inventory-slots:", err)
+		return strategy.Options{}, err
+	}
+	if inventorySlots < 0 {
+		return strategy.Options{}, errors.New("--inventory-slots cannot be negative")
+	}
+	stackSizes := make(map[string]uint, len(config.BulkItems))
+	for itemID, item := range config.BulkItems {
+		stackSizes[itemID] = item.StackSize
+	}
+
+	riskAdjusted, err := cmd.Flags().GetBool("risk-adjusted")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --risk-adjusted:", err)
+		return strategy.Options{}, err
+	}
+
+	return strategy.Options{
+		Algorithm:          algorithm,
+		MaxSlippage:        maxSlippage,
+		MinGainPercent:     minGainPercent,
+		MinGain:            minGain,
+		LegFriction:        legFriction,
+		ReferenceCurrency:  referenceCurrency,
+		MaxLegs:            maxLegs,
+		MustInclude:        mustInclude,
+		ExcludeItems:       excludeItems,
+		InventorySlots:     inventorySlots,
+		StackSizes:         stackSizes,
+		FavoritePlayers:    config.FavoritePlayers,
+		SortByRiskAdjusted: riskAdjusted,
+	}, nil
+}
+
+// addScanFlags registers the flags read by newTradeScan
+func addScanFlags(cmd *cobra.Command) {
+	addStrategyFlags(cmd)
+
+	cmd.Flags().String(
+		"record",
+		"",
+		"Save every exchange API response to the provided directory",
+	)
+
+	cmd.Flags().String(
+		"replay",
+		"",
+		"Serve exchange API responses from a directory created by --record",
+	)
+
+	cmd.Flags().Uint(
+		"depth",
+		20,
+		"Max number of listings fetched per trading pair (fetched in pages of 20)",
+	)
+
+	cmd.Flags().Int(
+		"workers",
+		2,
+		"Number of trading pairs fetched concurrently (subject to rate limits)",
+	)
+
+	cmd.Flags().Float64(
+		"outlier-mad",
+		5,
+		"Flag listings whose ratio is better than the book by more than this many median absolute deviations (0 disables)",
+	)
+
+	cmd.Flags().Int(
+		"bait-repeats",
+		3,
+		"Flag every listing of sellers with this many distinct listings flagged within the last hour (0 disables)",
+	)
+
+	cmd.Flags().Bool(
+		"exclude-flagged",
+		false,
+		"Exclude flagged listings (outliers, stock below the quoted amount and repeat offenders) from the analysis",
+	)
+
+	cmd.Flags().Duration(
+		"request-timeout",
+		10*time.Second,
+		"Timeout of a single exchange API request (excluding rate-limit waits)",
+	)
+
+	cmd.Flags().String(
+		"history",
+		"",
+		"Record every fetched order book to this file (default is historyFile in the config)",
+	)
+
+	cmd.Flags().String(
+		"journal",
+		"",
+		"Filter and sort sellers by their recorded whisper outcomes (default is journalFile in the config)",
+	)
+}
+
+// newTradeScan creates a scan of items based on the flags from addScanFlags
+func newTradeScan(cmd *cobra.Command, items []string, config Config, minLegs int) (tradeScan, error) {
+	initialCapital, err := cmd.Flags().GetStringToInt("capital")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not parse --capital argument:", err)
+		return tradeScan{}, err
+	}
+
+	options, err := parseStrategyOptions(cmd, config, minLegs)
+	if err != nil {
+		return tradeScan{}, err
+	}
+	// Routes are neither valued nor constrained to --must-include
+	if minLegs == routeMinLegs {
+		options.ReferenceCurrency = ""
+		options.MustInclude = nil
+	}
+	if options.ReferenceCurrency != "" && !utils.Contains(items, options.ReferenceCurrency) {
+		if cmd.Flags().Changed("reference") {
+			return tradeScan{}, fmt.Errorf("--reference %s must be one of the scanned items", options.ReferenceCurrency)
+		}
+		// Only the items being scanned can be valued
+		fmt.Fprintf(os.Stderr, "Reference currency %s is not one of the scanned items, skipping valuation\n", options.ReferenceCurrency)
+		options.ReferenceCurrency = ""
+	}
+	for _, item := range options.MustInclude {
+		if !utils.Contains(items, item) {
+			return tradeScan{}, fmt.Errorf("--must-include item %s must be one of the scanned items", item)
+		}
+	}
+
+	depth, err := cmd.Flags().GetUint("depth")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --depth:", err)
+		return tradeScan{}, err
+	}
+	if depth == 0 {
+		return tradeScan{}, errors.New("--depth must be at least 1")
+	}
+
+	workers, err := cmd.Flags().GetInt("workers")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --workers:", err)
+		return tradeScan{}, err
+	}
+	if workers < 1 {
+		return tradeScan{}, errors.New("--workers must be at least 1")
+	}
+
+	outlierMAD, err := cmd.Flags().GetFloat64("outlier-mad")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --outlier-mad:", err)
+		return tradeScan{}, err
+	}
+	if outlierMAD < 0 {
+		return tradeScan{}, errors.New("--outlier-mad cannot be negative")
+	}
+	baitRepeats, err := cmd.Flags().GetInt("bait-repeats")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --bait-repeats:", err)
+		return tradeScan{}, err
+	}
+	if baitRepeats < 0 {
+		return tradeScan{}, errors.New("--bait-repeats cannot be negative")
+	}
+	excludeFlagged, err := cmd.Flags().GetBool("exclude-flagged")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --exclude-flagged:", err)
+		return tradeScan{}, err
+	}
+
+	exchangeClient, err := newExchangeClient(cmd, config)
+	if err != nil {
+		return tradeScan{}, err
+	}
+
+	historyFile, err := cmd.Flags().GetString("history")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --history:", err)
+		return tradeScan{}, err
+	}
+	historyRecorder, err := newHistoryRecorder(historyFile, config)
+	if err != nil {
+		return tradeScan{}, err
+	}
+
+	journalFile, err := cmd.Flags().GetString("journal")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --journal:", err)
+		return tradeScan{}, err
+	}
+	journalFile, err = resolveJournalFile(journalFile, config)
+	if err != nil {
+		return tradeScan{}, err
+	}
+
+	return tradeScan{
+		exchange: exchangeClient,
+		items:    items,
+		capital:  initialCapital,
+		options:  options,
+		fetch: fetchOptions{
+			depth:    depth,
+			workers:  workers,
+			outliers: newOutlierFilter(outlierMAD, baitRepeats, excludeFlagged),
+		},
+		config:      config,
+		history:     historyRecorder,
+		journalFile: journalFile,
+	}, nil
+}
+
+// newExchangeClient creates a client based on the --record and --replay flags
+func newExchangeClient(cmd *cobra.Command, config Config) (*api.Client, error) {
+	recordDir, err := cmd.Flags().GetString("record")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --record:", err)
+		return nil, err
+	}
+	replayDir, err := cmd.Flags().GetString("replay")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --replay:", err)
+		return nil, err
+	}
+	recordDir = strings.TrimSpace(recordDir)
+	replayDir = strings.TrimSpace(replayDir)
+
+	league := getLeague(config)
+	if replayDir != "" {
+		if recordDir != "" {
+			return nil, errors.New("--record and --replay cannot be used together")
+		}
+		client, err := api.NewReplayClient(config.BaseURL, league, replayDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to replay exchange responses:", err)
+			return nil, err
+		}
+		return client, nil
+	}
+
+	requestTimeout, err := cmd.Flags().GetDuration("request-timeout")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse --request-timeout:", err)
+		return nil, err
+	}
+	if requestTimeout <= 0 {
+		return nil, errors.New("--request-timeout must be positive")
+	}
+
+	httpClient := http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+	}
+	if recordDir != "" {
+		client, err := api.NewRecordingClient(httpClient, config.BaseURL, league, recordDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to record exchange responses:", err)
+			return nil, err
+		}
+		return client, nil
+	}
+	return api.NewClient(httpClient, config.BaseURL, league), nil
+}
+
+// tradeScan bundles everything needed to fetch and analyze a set of items
+type tradeScan struct {
+	exchange api.Exchange
+	items    []string
+	capital  map[string]int
+	options  strategy.Options
+	fetch    fetchOptions
+	config   Config
+	// Optional, every fetched order book is recorded if set
+	history *historyRecorder
+	// Optional, reloaded before every fetch to pick up marked whispers
+	journalFile string
+}
+
+// run fetches the listings of every trading pair and returns the resulting
+// trading paths along with the profitable opportunities
+func (s tradeScan) run(ctx context.Context) (*strategy.TradingPaths, []strategy.Opportunity, error) {
+	tradingPaths, opportunities, _, err := s.runPartial(ctx)
+	return tradingPaths, opportunities, err
+}
+
+// runPartial is run but also returns the trading pairs that failed to fetch
+// and are therefore missing from the opportunities
+func (s tradeScan) runPartial(ctx context.Context) (
+	*strategy.TradingPaths,
+	[]strategy.Opportunity,
+	[]strategy.TradingPair,
+	error,
+) {
+	tradingPaths, failedPairs, err := s.fetchPairs(ctx, allTradingPairs(s.items))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	opportunities, err := tradingPaths.Analyze()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to analyze bulk trades:", err)
+		return nil, nil, nil, err
+	}
+
+	return tradingPaths, opportunities, failedPairs, nil
+}
+
+// fetchPairs fetches the listings of pairs and records them to the history.
+// Pairs that failed to fetch are returned along with the trading paths.
+func (s tradeScan) fetchPairs(ctx context.Context, pairs []strategy.TradingPair) (
+	*strategy.TradingPaths,
+	[]strategy.TradingPair,
+	error,
+) {
+	scanTime := time.Now()
+	// Listings are not ranked by reputation for this scan if the journal is
+	// unavailable (e.g. held by journal mark)
+	reputation, err := loadReputation(s.journalFile, s.config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to read journal, ignoring reputation:", err)
+	}
+	fetch := s.fetch
+	fetch.reputation = reputation
+	fetch.outliers.startScan(scanTime)
+
+	tradingPaths := strategy.NewTradingPaths(s.capital, s.options)
+	failedPairs, err := fetchTradingPaths(ctx, s.exchange, pairs, tradingPaths, fetch, s.config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to fetch bulk trades:", err)
+		return nil, nil, err
+	}
+
+	// History is best-effort and should not prevent the analysis
+	if s.history != nil {
+		if err := s.history.record(scanTime, tradingPaths, s.config); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to record order book history:", err)
+		}
+	}
+	return tradingPaths, failedPairs, nil
+}
+
+// flags returns the listings flagged by the last scan
+func (s tradeScan) flags() listingFlags {
+	return s.fetch.outliers.scanFlags()
+}
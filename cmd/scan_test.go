@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/strategy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// testdata/replay is a recorded scan of chaos, exalted and gcp in Standard
+func TestScanReplay(t *testing.T) {
+	exchange, err := api.NewReplayClient("", "Standard", "testdata/replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan := tradeScan{
+		exchange: exchange,
+		items:    []string{"chaos", "exalted", "gcp"},
+		capital:  map[string]int{"chaos": 1000},
+		options:  strategy.Options{MinGainPercent: 1},
+		fetch:    fetchOptions{depth: 10, workers: 2},
+	}
+	tradingPaths, opportunities, err := scan.run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(tradingPaths.TradingPairs()); got != 6 {
+		t.Errorf("fetched %d trading pairs, want 6", got)
+	}
+
+	if len(opportunities) != 1 {
+		t.Fatalf("run() returned %d opportunities, want 1", len(opportunities))
+	}
+	opportunity := opportunities[0]
+	if opportunity.Key() != "chaos>gcp>exalted>chaos" {
+		t.Errorf("Key() = %s, want chaos>gcp>exalted>chaos", opportunity.Key())
+	}
+	// 240 gcp buy the 2 exalted that e1 has in stock at 120 gcp each and are
+	// sold to b1 for 140 chaos each
+	if math.Abs(opportunity.GainPercent-50.0/3) > 1e-9 {
+		t.Errorf("GainPercent = %f, want %f", opportunity.GainPercent, 50.0/3)
+	}
+	if math.Abs(opportunity.Profit-40) > 1e-9 {
+		t.Errorf("Profit = %f, want 40", opportunity.Profit)
+	}
+	if opportunity.OutputAmount != 280 {
+		t.Errorf("OutputAmount = %d, want 280", opportunity.OutputAmount)
+	}
+	wantAccounts := []string{"c1", "e1", "b1"}
+	for i, leg := range opportunity.Legs {
+		if len(leg.Fills) == 0 || leg.Fills[0].Listing.Account != wantAccounts[i] {
+			t.Errorf("leg %d fills = %+v, want %s first", i, leg.Fills, wantAccounts[i])
+		}
+	}
+}
+
+// setBulkItems configures the items accepted by validateItems
+func setBulkItems(t *testing.T, items ...string) {
+	t.Helper()
+	bulkItems := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		bulkItems[item] = map[string]interface{}{"id": item, "name": item, "stackSize": 10}
+	}
+	viper.Set("bulkItems", bulkItems)
+	t.Cleanup(viper.Reset)
+}
+
+func newTestScanCommand(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+	cmd := &cobra.Command{Use: "test"}
+	addScanFlags(cmd)
+	if err := cmd.ParseFlags(append([]string{"--replay", "testdata/replay"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestNewTradeScanReference(t *testing.T) {
+	setBulkItems(t, "chaos", "exalted", "gcp")
+	items := []string{"chaos", "gcp"}
+
+	// Configured for other scans, skipped instead of failing this one
+	scan, err := newTradeScan(newTestScanCommand(t), items, Config{ReferenceCurrency: "exalted"}, cycleMinLegs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scan.options.ReferenceCurrency != "" {
+		t.Errorf("ReferenceCurrency = %s, want none", scan.options.ReferenceCurrency)
+	}
+
+	scan, err = newTradeScan(newTestScanCommand(t), items, Config{ReferenceCurrency: "chaos"}, cycleMinLegs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scan.options.ReferenceCurrency != "chaos" {
+		t.Errorf("ReferenceCurrency = %s, want chaos", scan.options.ReferenceCurrency)
+	}
+
+	if _, err := newTradeScan(newTestScanCommand(t, "--reference", "exalted"), items, Config{}, cycleMinLegs); err == nil {
+		t.Error("newTradeScan() accepted a --reference that is not scanned")
+	}
+}
+
+func TestNewTradeScanRoute(t *testing.T) {
+	setBulkItems(t, "chaos", "exalted", "gcp", "divine")
+	config := Config{League: "Standard", ReferenceCurrency: "exalted"}
+
+	scan, err := newTradeScan(newTestScanCommand(t, "--must-include", "divine"), []string{"chaos", "gcp"}, config, routeMinLegs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scan.options.ReferenceCurrency != "" || len(scan.options.MustInclude) != 0 {
+		t.Errorf("options = %+v, want no reference or must-include items", scan.options)
+	}
+
+	tradingPaths, _, err := scan.fetchPairs(context.Background(), conversionPairs(scan.items, "chaos", "gcp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tradingPaths.BestRoute("chaos", "gcp", 100); !ok {
+		t.Error("BestRoute() found no route from chaos to gcp")
+	}
+}
@@ -0,0 +1,328 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/strategy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the latest trading opportunities over HTTP",
+	Long: `
+Scan the provided items in the background and expose the results as JSON:
+
+  GET /opportunities              latest profitable trading paths
+  GET /pairs/{have}/{want}/book   listings of a trading pair
+  GET /items                      scanned bulk items
+  GET /health                     scan status
+`,
+	Args: validateScanArgs,
+	RunE: func(cmd *cobra.Command, items []string) error {
+		var config Config
+		if err := viper.Unmarshal(&config); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse config:", err)
+			return err
+		}
+
+		addr, err := cmd.Flags().GetString("addr")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --addr:", err)
+			return err
+		}
+
+		interval, err := cmd.Flags().GetDuration("interval")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --interval:", err)
+			return err
+		}
+		if interval <= 0 {
+			return errors.New("--interval must be positive")
+		}
+
+		scan, err := newTradeScan(cmd, items, config, cycleMinLegs)
+		if err != nil {
+			return err
+		}
+
+		server := &opportunityServer{
+			scan:     scan,
+			interval: interval,
+		}
+		return server.listenAndServe(cmd.Context(), addr)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	addScanFlags(serveCmd)
+
+	serveCmd.Flags().String(
+		"addr",
+		"127.0.0.1:8080",
+		"Address the HTTP server listens on",
+	)
+
+	serveCmd.Flags().Duration(
+		"interval",
+		2*time.Minute,
+		"Time between scans",
+	)
+}
+
+// opportunityServer shares the results of a single background scan loop with
+// every HTTP client so the exchange API is only queried once per interval
+type opportunityServer struct {
+	scan     tradeScan
+	interval time.Duration
+
+	mu sync.RWMutex
+	// Replaced after every successful scan and never mutated afterwards
+	tradingPaths  *strategy.TradingPaths
+	opportunities []strategy.Opportunity
+	flags         listingFlags
+	updatedAt     time.Time
+	scans         int
+	lastError     string
+	lastErrorAt   time.Time
+}
+
+type healthResponse struct {
+	Status      string     `json:"status"`
+	Scans       int        `json:"scans"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+type opportunitiesResponse struct {
+	UpdatedAt     time.Time            `json:"updatedAt"`
+	Opportunities []flaggedOpportunity `json:"opportunities"`
+}
+
+type bookResponse struct {
+	UpdatedAt time.Time            `json:"updatedAt"`
+	Pair      strategy.TradingPair `json:"pair"`
+	Listings  []api.TradeDetail    `json:"listings"`
+	// Flags of the listings keyed by listing ID
+	Flags listingFlags `json:"flags,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *opportunityServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/opportunities", s.handleOpportunities)
+	mux.HandleFunc("/pairs/", s.handleBook)
+	mux.HandleFunc("/items", s.handleItems)
+	mux.HandleFunc("/health", s.handleHealth)
+	return mux
+}
+
+func (s *opportunityServer) listenAndServe(ctx context.Context, addr string) error {
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go s.scanLoop(ctx)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintln(os.Stderr, "Listening on", addr)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "HTTP server failed:", err)
+		return err
+	}
+	return nil
+}
+
+func (s *opportunityServer) scanLoop(ctx context.Context) {
+	for {
+		s.scanOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		timer := time.NewTimer(s.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// scanOnce runs a scan and publishes its results, or its error if it failed
+func (s *opportunityServer) scanOnce(ctx context.Context) {
+	tradingPaths, opportunities, err := s.scan.run(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.lastError = err.Error()
+		s.lastErrorAt = time.Now()
+		return
+	}
+	if opportunities == nil {
+		opportunities = make([]strategy.Opportunity, 0)
+	}
+	s.tradingPaths = tradingPaths
+	s.opportunities = opportunities
+	s.flags = s.scan.flags()
+	s.updatedAt = time.Now()
+	s.scans++
+}
+
+func (s *opportunityServer) handleOpportunities(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.tradingPaths == nil {
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "first scan has not completed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, opportunitiesResponse{
+		UpdatedAt:     s.updatedAt,
+		Opportunities: flagOpportunities(s.opportunities, s.flags),
+	})
+}
+
+// Handles /pairs/{have}/{want}/book
+func (s *opportunityServer) handleBook(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/pairs/"), "/"), "/")
+	if len(segments) != 3 || segments[2] != "book" || segments[0] == "" || segments[1] == "" {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "expected /pairs/{have}/{want}/book"})
+		return
+	}
+	pair := strategy.TradingPair{
+		InitialItem: segments[0],
+		TargetItem:  segments[1],
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.tradingPaths == nil {
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "first scan has not completed"})
+		return
+	}
+
+	listings := s.tradingPaths.Get(pair.InitialItem, pair.TargetItem)
+	if listings == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{
+			Error: fmt.Sprintf("no listings for %s => %s", pair.InitialItem, pair.TargetItem),
+		})
+		return
+	}
+	flags := make(listingFlags)
+	for _, listing := range *listings {
+		if reasons := s.flags.get(pair, listing); len(reasons) > 0 {
+			flags[strategy.ListingKey(pair, listing)] = reasons
+		}
+	}
+	writeJSON(w, http.StatusOK, bookResponse{
+		UpdatedAt: s.updatedAt,
+		Pair:      pair,
+		Listings:  *listings,
+		Flags:     flags,
+	})
+}
+
+func (s *opportunityServer) handleItems(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	items := make([]BulkItem, 0, len(s.scan.items))
+	for _, itemID := range s.scan.items {
+		item, ok := s.scan.config.BulkItems[itemID]
+		if !ok {
+			item = BulkItem{ID: itemID}
+		}
+		items = append(items, item)
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+func (s *opportunityServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	response := healthResponse{
+		Status:    "ok",
+		Scans:     s.scans,
+		LastError: s.lastError,
+	}
+	if !s.updatedAt.IsZero() {
+		updatedAt := s.updatedAt
+		response.UpdatedAt = &updatedAt
+	}
+	if !s.lastErrorAt.IsZero() {
+		lastErrorAt := s.lastErrorAt
+		response.LastErrorAt = &lastErrorAt
+	}
+
+	status := http.StatusOK
+	if s.tradingPaths == nil {
+		response.Status = "starting"
+		status = http.StatusServiceUnavailable
+	} else if s.lastErrorAt.After(s.updatedAt) {
+		response.Status = "degraded"
+	}
+	writeJSON(w, status, response)
+}
+
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	// Overlays run in the browser and are typically served from another origin
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to write response:", err)
+	}
+}
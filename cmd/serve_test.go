@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/strategy"
+)
+
+func requestJSON(t *testing.T, method, url string, value interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if value != nil {
+		if err := json.NewDecoder(resp.Body).Decode(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestOpportunityServer(t *testing.T) {
+	exchange, err := api.NewReplayClient("", "Standard", "testdata/replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &opportunityServer{scan: tradeScan{
+		exchange: exchange,
+		items:    []string{"chaos", "exalted", "gcp"},
+		capital:  map[string]int{"chaos": 1000},
+		options:  strategy.Options{MinGainPercent: 1},
+		fetch:    fetchOptions{depth: 10, workers: 2},
+	}}
+	httpServer := httptest.NewServer(server.handler())
+	defer httpServer.Close()
+
+	var health healthResponse
+	if status := requestJSON(t, http.MethodGet, httpServer.URL+"/health", &health); status != http.StatusServiceUnavailable {
+		t.Errorf("GET /health before the first scan = %d, want %d", status, http.StatusServiceUnavailable)
+	}
+	if health.Status != "starting" {
+		t.Errorf("health status = %s, want starting", health.Status)
+	}
+
+	server.scanOnce(context.Background())
+
+	if status := requestJSON(t, http.MethodGet, httpServer.URL+"/health", &health); status != http.StatusOK {
+		t.Errorf("GET /health = %d, want %d", status, http.StatusOK)
+	}
+	if health.Status != "ok" || health.Scans != 1 {
+		t.Errorf("health = %+v, want ok after 1 scan", health)
+	}
+
+	var opportunities opportunitiesResponse
+	if status := requestJSON(t, http.MethodGet, httpServer.URL+"/opportunities", &opportunities); status != http.StatusOK {
+		t.Errorf("GET /opportunities = %d, want %d", status, http.StatusOK)
+	}
+	if len(opportunities.Opportunities) != 1 || opportunities.Opportunities[0].Key() != "chaos>gcp>exalted>chaos" {
+		t.Errorf("opportunities = %+v, want chaos>gcp>exalted>chaos", opportunities.Opportunities)
+	}
+
+	var book bookResponse
+	if status := requestJSON(t, http.MethodGet, httpServer.URL+"/pairs/chaos/exalted/book", &book); status != http.StatusOK {
+		t.Errorf("GET /pairs/chaos/exalted/book = %d, want %d", status, http.StatusOK)
+	}
+	if book.Pair != (strategy.TradingPair{InitialItem: "chaos", TargetItem: "exalted"}) || len(book.Listings) == 0 {
+		t.Errorf("book = %+v, want the chaos => exalted listings", book)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/pairs/chaos/book", http.StatusNotFound},
+		{http.MethodGet, "/pairs/chaos/exalted", http.StatusNotFound},
+		{http.MethodGet, "/pairs/chaos/exalted/listings", http.StatusNotFound},
+		{http.MethodGet, "/pairs/chaos/divine/book", http.StatusNotFound},
+		{http.MethodPost, "/opportunities", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/pairs/chaos/exalted/book", http.StatusMethodNotAllowed},
+		{http.MethodPut, "/items", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/health", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			var response errorResponse
+			if status := requestJSON(t, tt.method, httpServer.URL+tt.path, &response); status != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, status, tt.want)
+			}
+			if strings.TrimSpace(response.Error) == "" {
+				t.Errorf("%s %s returned no error message", tt.method, tt.path)
+			}
+		})
+	}
+}
@@ -1,14 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"net/http"
+	"os"
 	"sort"
 	"time"
 
 	"github.com/t73liu/poe-arbitrage/api"
-	"github.com/t73liu/poe-arbitrage/strategy"
 	"github.com/t73liu/poe-arbitrage/utils"
 
 	"github.com/spf13/cobra"
@@ -18,46 +18,61 @@ import (
 var tradeCmd = &cobra.Command{
 	Use:   "trade",
 	Short: "Check for trading opportunities for bulk items",
-	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) < 2 {
-			return errors.New("provide at least 2 items")
-		}
-
-		if err := validateItems(args, "Invalid arguments: "); err != nil {
+	Args:  validateScanArgs,
+	RunE: func(cmd *cobra.Command, items []string) error {
+		var config Config
+		if err := viper.Unmarshal(&config); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse config:", err)
 			return err
 		}
 
-		initialCapital, err := cmd.Flags().GetStringToInt("capital")
+		outputFormat, err := cmd.Flags().GetString("output")
 		if err != nil {
-			fmt.Println("Could not parse --capital argument:", err)
+			fmt.Fprintln(os.Stderr, "Failed to parse --output:", err)
 			return err
 		}
-
-		capitalItems := make([]string, 0, len(initialCapital))
-		for item := range initialCapital {
-			capitalItems = append(capitalItems, item)
+		outputFormat, err = parseOutputFormat(outputFormat)
+		if err != nil {
+			return err
 		}
 
-		if err := validateItems(capitalItems, "Invalid capital: "); err != nil {
+		scan, err := newTradeScan(cmd, items, config, cycleMinLegs)
+		if err != nil {
 			return err
 		}
 
-		return nil
-	},
-	RunE: func(cmd *cobra.Command, items []string) error {
-		initialCapital, err := cmd.Flags().GetStringToInt("capital")
+		watch, err := cmd.Flags().GetBool("watch")
 		if err != nil {
-			fmt.Println("Could not parse --capital argument:", err)
+			fmt.Fprintln(os.Stderr, "Failed to parse --watch:", err)
 			return err
 		}
-
-		var config Config
-		if err := viper.Unmarshal(&config); err != nil {
-			fmt.Println("Failed to parse config:", err)
+		allocate, err := cmd.Flags().GetBool("allocate")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse --allocate:", err)
 			return err
 		}
+		if allocate {
+			if watch {
+				return errors.New("--allocate cannot be used with --watch")
+			}
+			if len(scan.capital) == 0 {
+				return errors.New("--allocate requires --capital")
+			}
+			return allocateBulkTrades(cmd.Context(), scan, outputFormat)
+		}
+		if watch {
+			interval, err := cmd.Flags().GetDuration("interval")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to parse --interval:", err)
+				return err
+			}
+			if interval <= 0 {
+				return errors.New("--interval must be positive")
+			}
+			return watchBulkTrades(cmd.Context(), scan, interval, outputFormat)
+		}
 
-		if err := analyzeBulkTrades(items, initialCapital, config); err != nil {
+		if err := analyzeBulkTrades(cmd.Context(), scan, outputFormat); err != nil {
 			return err
 		}
 
@@ -68,11 +83,31 @@ var tradeCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(tradeCmd)
 
-	tradeCmd.Flags().StringToIntP(
-		"capital",
-		"c",
-		make(map[string]int),
-		"Specify starting capital (i.e. chaos=40,exa=1).",
+	addScanFlags(tradeCmd)
+
+	tradeCmd.Flags().Bool(
+		"watch",
+		false,
+		"Re-scan the items every --interval and report changed opportunities",
+	)
+
+	tradeCmd.Flags().Duration(
+		"interval",
+		2*time.Minute,
+		"Time between scans in --watch mode",
+	)
+
+	tradeCmd.Flags().Bool(
+		"allocate",
+		false,
+		"Split --capital across opportunities without reusing listing stock and print an execution plan",
+	)
+
+	tradeCmd.Flags().StringP(
+		"output",
+		"o",
+		textOutput,
+		"Output format (text, json, ndjson, csv or table)",
 	)
 }
 
@@ -110,57 +145,25 @@ func getLeague(config Config) string {
 	}
 }
 
-func analyzeBulkTrades(items []string, capital map[string]int, config Config) error {
-	httpClient := http.Client{
-		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
-			TLSHandshakeTimeout: 5 * time.Second,
-		},
+func analyzeBulkTrades(ctx context.Context, scan tradeScan, outputFormat string) error {
+	_, opportunities, err := scan.run(ctx)
+	if err != nil {
+		return err
 	}
-	exchangeClient := api.NewClient(httpClient, getLeague(config))
-	tradingPaths := strategy.NewTradingPaths(capital)
-
-	for initialIndex, initialItem := range items {
-		for currIndex, currItem := range items {
-			if currIndex == initialIndex {
-				continue
-			}
-
-			bulkTrades, err := exchangeClient.GetBulkTrades(initialItem, currItem, 1)
-			if err != nil {
-				fmt.Println("Unable to fetch bulk trades:", err)
-				return err
-			}
 
-			tradeDetails, err := exchangeClient.GetTradeDetails(
-				bulkTrades.ID,
-				utils.Limit(bulkTrades.TradeIDs, 20),
-			)
-			if err != nil {
-				fmt.Println("Unable to fetch trade details:", initialItem, currItem)
-				return err
-			}
-
-			tradeDetails = filterTradeDetails(tradeDetails, config)
-			sortTrades(tradeDetails, config)
-			if len(*tradeDetails) > 0 {
-				if err := tradingPaths.Set(initialItem, currItem, tradeDetails); err != nil {
-					fmt.Println(err)
-					return err
-				}
-			}
-		}
-	}
+	return writeOpportunities(os.Stdout, outputFormat, opportunities, scan.flags())
+}
 
-	if err := tradingPaths.Analyze(); err != nil {
-		fmt.Println("Unable to analyze bulk trades:", err)
+func allocateBulkTrades(ctx context.Context, scan tradeScan, outputFormat string) error {
+	tradingPaths, opportunities, err := scan.run(ctx)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return writePlan(os.Stdout, outputFormat, tradingPaths.Allocate(opportunities), scan.flags())
 }
 
-func filterTradeDetails(tradeDetails *[]api.TradeDetail, config Config) *[]api.TradeDetail {
+func filterTradeDetails(tradeDetails *[]api.TradeDetail, config Config, reputation *reputation) *[]api.TradeDetail {
 	filteredTrades := make([]api.TradeDetail, 0, len(*tradeDetails))
 	for _, trade := range *tradeDetails {
 		if config.ExcludeAFK && trade.AFK {
@@ -169,12 +172,15 @@ func filterTradeDetails(tradeDetails *[]api.TradeDetail, config Config) *[]api.T
 		if utils.Contains(config.IgnoredPlayers, trade.Account) {
 			continue
 		}
+		if reputation.ignored(trade.Account) {
+			continue
+		}
 		filteredTrades = append(filteredTrades, trade)
 	}
 	return &filteredTrades
 }
 
-func sortTrades(tradeDetails *[]api.TradeDetail, config Config) {
+func sortTrades(tradeDetails *[]api.TradeDetail, config Config, reputation *reputation) {
 	hasFavorite := len(config.FavoritePlayers) != 0
 	less := func(i, j int) bool {
 		curr := (*tradeDetails)[i]
@@ -189,9 +195,16 @@ func sortTrades(tradeDetails *[]api.TradeDetail, config Config) {
 			if hasFavorite && currFavorite && !nextFavorite {
 				return true
 			} else if currFavorite == nextFavorite {
-				// Prefer trades with more stock
-				if next.Stock < curr.Stock {
+				currScore := reputation.score(curr.Account)
+				nextScore := reputation.score(next.Account)
+				// Prefer trades with players that complete more whispers
+				if nextScore < currScore {
 					return true
+				} else if nextScore == currScore {
+					// Prefer trades with more stock
+					if next.Stock < curr.Stock {
+						return true
+					}
 				}
 			}
 		}
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/journal"
+	"github.com/t73liu/poe-arbitrage/strategy"
+)
+
+// fakeExchange serves the listings of every trading pair keyed by
+// "have>want", pairs without listings fail
+type fakeExchange struct {
+	listings map[string][]api.TradeDetail
+}
+
+func (e fakeExchange) GetBulkTrades(_ context.Context, initialItem, targetItem string, _ uint) (*api.Trades, error) {
+	key := initialItem + ">" + targetItem
+	listings, ok := e.listings[key]
+	if !ok {
+		return nil, errors.New("no listings for " + key)
+	}
+	ids := make([]string, 0, len(listings))
+	for _, listing := range listings {
+		ids = append(ids, listing.ID)
+	}
+	return &api.Trades{ID: key, TradeIDs: ids, Total: uint(len(ids))}, nil
+}
+
+func (e fakeExchange) GetTradeDetails(_ context.Context, queryID string, tradeIDs []string) (*[]api.TradeDetail, error) {
+	tradeDetails := make([]api.TradeDetail, 0, len(tradeIDs))
+	for _, listing := range e.listings[queryID] {
+		for _, id := range tradeIDs {
+			if listing.ID == id {
+				tradeDetails = append(tradeDetails, listing)
+			}
+		}
+	}
+	return &tradeDetails, nil
+}
+
+func tradeDetail(id, account string, price, item, stock uint) api.TradeDetail {
+	return api.TradeDetail{
+		ID:          id,
+		Account:     account,
+		Whisper:     "@" + account + " buy {0} for {1}",
+		PriceAmount: price,
+		ItemAmount:  item,
+		Stock:       stock,
+		Ratio:       float64(item) / float64(price),
+	}
+}
+
+func tradeIDs(tradeDetails []api.TradeDetail) []string {
+	ids := make([]string, 0, len(tradeDetails))
+	for _, trade := range tradeDetails {
+		ids = append(ids, trade.ID)
+	}
+	return ids
+}
+
+func TestFilterTradeDetails(t *testing.T) {
+	afk := tradeDetail("afk", "away", 10, 1, 10)
+	afk.AFK = true
+	tradeDetails := []api.TradeDetail{
+		tradeDetail("ok", "seller", 10, 1, 10),
+		afk,
+		tradeDetail("ignored", "scammer", 10, 1, 10),
+		tradeDetail("unreliable", "flaky", 10, 1, 10),
+	}
+	flaky := &reputation{
+		stats:              map[string]journal.AccountStats{"flaky": {Account: "flaky", ConsecutiveFailures: 3}},
+		autoIgnoreFailures: 3,
+	}
+
+	tests := []struct {
+		name       string
+		config     Config
+		reputation *reputation
+		want       []string
+	}{
+		{"no filters", Config{}, nil, []string{"ok", "afk", "ignored", "unreliable"}},
+		{"exclude afk", Config{ExcludeAFK: true}, nil, []string{"ok", "ignored", "unreliable"}},
+		{"ignored players", Config{IgnoredPlayers: []string{"scammer"}}, nil, []string{"ok", "afk", "unreliable"}},
+		{"auto ignored accounts", Config{}, flaky, []string{"ok", "afk", "ignored"}},
+		{
+			"auto ignore disabled",
+			Config{},
+			&reputation{stats: flaky.stats},
+			[]string{"ok", "afk", "ignored", "unreliable"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := filterTradeDetails(&tradeDetails, tt.config, tt.reputation)
+			if ids := tradeIDs(*got); !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("filterTradeDetails() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortTrades(t *testing.T) {
+	accounts := &reputation{
+		stats: map[string]journal.AccountStats{
+			"reliable":   {Account: "reliable", Whispers: 4, Completed: 4},
+			"unreliable": {Account: "unreliable", Whispers: 4, Completed: 1},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		tradeDetails []api.TradeDetail
+		config       Config
+		want         []string
+	}{
+		{
+			"highest ratio first",
+			[]api.TradeDetail{
+				tradeDetail("low", "a", 10, 1, 100),
+				tradeDetail("high", "b", 8, 1, 1),
+			},
+			Config{},
+			[]string{"high", "low"},
+		},
+		{
+			"favorite players break ties",
+			[]api.TradeDetail{
+				tradeDetail("stranger", "reliable", 10, 1, 100),
+				tradeDetail("favorite", "friend", 10, 1, 1),
+			},
+			Config{FavoritePlayers: []string{"friend"}},
+			[]string{"favorite", "stranger"},
+		},
+		{
+			"completion rate breaks ties",
+			[]api.TradeDetail{
+				tradeDetail("unreliable", "unreliable", 10, 1, 100),
+				tradeDetail("unknown", "new", 10, 1, 100),
+				tradeDetail("reliable", "reliable", 10, 1, 1),
+			},
+			Config{},
+			[]string{"reliable", "unknown", "unreliable"},
+		},
+		{
+			"stock breaks ties",
+			[]api.TradeDetail{
+				tradeDetail("small", "new", 10, 1, 5),
+				tradeDetail("large", "other", 10, 1, 50),
+			},
+			Config{},
+			[]string{"large", "small"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sortTrades(&tt.tradeDetails, tt.config, accounts)
+			if ids := tradeIDs(tt.tradeDetails); !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("sortTrades() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchTradingPaths(t *testing.T) {
+	exchange := fakeExchange{listings: map[string][]api.TradeDetail{
+		"chaos>exalted": {
+			tradeDetail("ce1", "a", 11, 1, 100),
+			tradeDetail("ce2", "scammer", 10, 1, 100),
+			tradeDetail("ce3", "b", 10, 1, 100),
+		},
+		"exalted>chaos": {
+			tradeDetail("ec1", "c", 1, 12, 1000),
+		},
+		// chaos>gcp and the pairs ending in gcp fail and are skipped
+	}}
+	config := Config{IgnoredPlayers: []string{"scammer"}, MinGainPercent: 1}
+	tradingPaths := strategy.NewTradingPaths(map[string]int{"chaos": 100}, strategy.Options{MinGainPercent: 1})
+
+	failedPairs, err := fetchTradingPaths(
+		context.Background(),
+		exchange,
+		allTradingPairs([]string{"chaos", "exalted", "gcp"}),
+		tradingPaths,
+		fetchOptions{depth: 2, workers: 2},
+		config,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failedPairs) != 4 {
+		t.Errorf("fetchTradingPaths() failed %d trading pairs, want 4", len(failedPairs))
+	}
+
+	opportunities, err := tradingPaths.Analyze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opportunities) != 1 {
+		t.Fatalf("Analyze() returned %d opportunities, want 1", len(opportunities))
+	}
+	opportunity := opportunities[0]
+	if opportunity.Key() != "chaos>exalted>chaos" {
+		t.Errorf("Key() = %s, want chaos>exalted>chaos", opportunity.Key())
+	}
+	// Only the first two listings are fetched and the ignored player is
+	// dropped, leaving the worse of the two ratios
+	fills := opportunity.Legs[0].Fills
+	if len(fills) != 1 || fills[0].Listing.Account != "a" {
+		t.Errorf("first leg fills = %+v, want a single fill from a", fills)
+	}
+
+	_, err = fetchTradingPaths(
+		context.Background(),
+		fakeExchange{},
+		allTradingPairs([]string{"chaos", "exalted"}),
+		strategy.NewTradingPaths(nil, strategy.Options{}),
+		fetchOptions{depth: 2},
+		config,
+	)
+	if err == nil {
+		t.Error("fetchTradingPaths() succeeded without fetching any trading pair")
+	}
+}
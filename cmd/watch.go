@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/strategy"
+)
+
+const (
+	newOpportunity      = "new"
+	removedOpportunity  = "removed"
+	improvedOpportunity = "improved"
+	worsenedOpportunity = "worsened"
+)
+
+// Gain changes smaller than this (in percentage points) are not reported
+const gainChangeThreshold = 0.001
+
+type opportunityChange struct {
+	Time   time.Time `json:"time"`
+	Change string    `json:"change"`
+	// Gain reported in the previous scan, only set for improved/worsened
+	PreviousGainPercent float64              `json:"previousGainPercent,omitempty"`
+	Opportunity         strategy.Opportunity `json:"opportunity"`
+	// Flags of the listings filled by the opportunity in the latest scan
+	Flags listingFlags `json:"flags,omitempty"`
+}
+
+// watchBulkTrades re-scans the items every interval and reports opportunities
+// that appeared, disappeared or changed since the previous scan. Failed scans
+// are logged and retried on the next interval, opportunities trading a pair
+// that failed to fetch are carried forward instead of reported as removed.
+func watchBulkTrades(ctx context.Context, scan tradeScan, interval time.Duration, outputFormat string) error {
+	if outputFormat == csvOutput || outputFormat == tableOutput {
+		return fmt.Errorf("--watch does not support %s output", outputFormat)
+	}
+
+	var previous map[string]strategy.Opportunity
+	for scanNumber := 1; ; scanNumber++ {
+		scanTime := time.Now()
+		_, opportunities, failedPairs, err := scan.runPartial(ctx)
+		// A partial scan would report every missing pair as removed
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Scan failed, retrying in", interval)
+		} else {
+			// Keyed by cycle so that a new entry point is not reported as a new path
+			current := make(map[string]strategy.Opportunity, len(opportunities))
+			for _, opportunity := range opportunities {
+				current[opportunity.CycleKey()] = opportunity
+			}
+			carryForward(previous, current, failedPairs)
+
+			changes := diffOpportunities(previous, current, scanTime)
+			flags := scan.flags()
+			for i := range changes {
+				if changes[i].Change != removedOpportunity {
+					changes[i].Flags = flags.forLegs(changes[i].Opportunity.Legs)
+				}
+			}
+			if err := writeOpportunityChanges(os.Stdout, outputFormat, scanNumber, scanTime, changes, flags); err != nil {
+				return err
+			}
+			previous = current
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// carryForward copies the previous opportunities that trade one of the failed
+// pairs into current since their listings are unknown
+func carryForward(previous, current map[string]strategy.Opportunity, failedPairs []strategy.TradingPair) {
+	if len(failedPairs) == 0 {
+		return
+	}
+	for key, opportunity := range previous {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		for _, pair := range opportunity.Path {
+			if containsTradingPair(failedPairs, pair) {
+				current[key] = opportunity
+				break
+			}
+		}
+	}
+}
+
+func containsTradingPair(pairs []strategy.TradingPair, pair strategy.TradingPair) bool {
+	for _, el := range pairs {
+		if el == pair {
+			return true
+		}
+	}
+	return false
+}
+
+func diffOpportunities(previous, current map[string]strategy.Opportunity, scanTime time.Time) []opportunityChange {
+	changes := make([]opportunityChange, 0, len(current))
+	for key, opportunity := range current {
+		previousOpportunity, ok := previous[key]
+		if !ok {
+			changes = append(changes, opportunityChange{
+				Time:        scanTime,
+				Change:      newOpportunity,
+				Opportunity: opportunity,
+			})
+			continue
+		}
+
+		gainChange := opportunity.GainPercent - previousOpportunity.GainPercent
+		if gainChange > gainChangeThreshold {
+			changes = append(changes, opportunityChange{
+				Time:                scanTime,
+				Change:              improvedOpportunity,
+				PreviousGainPercent: previousOpportunity.GainPercent,
+				Opportunity:         opportunity,
+			})
+		} else if gainChange < -gainChangeThreshold {
+			changes = append(changes, opportunityChange{
+				Time:                scanTime,
+				Change:              worsenedOpportunity,
+				PreviousGainPercent: previousOpportunity.GainPercent,
+				Opportunity:         opportunity,
+			})
+		}
+	}
+
+	for key, opportunity := range previous {
+		if _, ok := current[key]; !ok {
+			changes = append(changes, opportunityChange{
+				Time:        scanTime,
+				Change:      removedOpportunity,
+				Opportunity: opportunity,
+			})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Change != changes[j].Change {
+			return changes[i].Change < changes[j].Change
+		}
+		return changes[i].Opportunity.Key() < changes[j].Opportunity.Key()
+	})
+	return changes
+}
+
+func writeOpportunityChanges(
+	w io.Writer,
+	format string,
+	scanNumber int,
+	scanTime time.Time,
+	changes []opportunityChange,
+	flags listingFlags,
+) error {
+	switch format {
+	case jsonOutput:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(changes)
+	case ndjsonOutput:
+		encoder := json.NewEncoder(w)
+		for _, change := range changes {
+			if err := encoder.Encode(change); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		fmt.Fprintf(w, "=== Scan %d at %s ===\n", scanNumber, scanTime.Format(time.RFC3339))
+		if len(changes) == 0 {
+			fmt.Fprintln(w, "No changes.")
+			fmt.Fprintln(w)
+			return nil
+		}
+
+		for _, change := range changes {
+			opportunity := change.Opportunity
+			switch change.Change {
+			case newOpportunity:
+				fmt.Fprintf(w, "+ NEW %s (%.3f%%)\n", opportunity.Key(), opportunity.GainPercent)
+			case removedOpportunity:
+				fmt.Fprintf(w, "- REMOVED %s (was %.3f%%)\n", opportunity.Key(), opportunity.GainPercent)
+			case improvedOpportunity:
+				fmt.Fprintf(
+					w,
+					"^ IMPROVED %s (%.3f%% => %.3f%%)\n",
+					opportunity.Key(),
+					change.PreviousGainPercent,
+					opportunity.GainPercent,
+				)
+			case worsenedOpportunity:
+				fmt.Fprintf(
+					w,
+					"v WORSENED %s (%.3f%% => %.3f%%)\n",
+					opportunity.Key(),
+					change.PreviousGainPercent,
+					opportunity.GainPercent,
+				)
+			}
+		}
+		fmt.Fprintln(w)
+
+		// Whispers are only useful for paths that are still available
+		actionable := make([]strategy.Opportunity, 0, len(changes))
+		for _, change := range changes {
+			if change.Change == newOpportunity || change.Change == improvedOpportunity {
+				actionable = append(actionable, change.Opportunity)
+			}
+		}
+		if len(actionable) > 0 {
+			printOpportunities(w, actionable, flags)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/strategy"
+)
+
+func TestDiffOpportunitiesCarriesForwardFailedPairs(t *testing.T) {
+	exaltedCycle := strategy.Opportunity{
+		StartItem:   "chaos",
+		Path:        []strategy.TradingPair{{InitialItem: "chaos", TargetItem: "exalted"}, {InitialItem: "exalted", TargetItem: "chaos"}},
+		GainPercent: 5,
+	}
+	gcpCycle := strategy.Opportunity{
+		StartItem:   "chaos",
+		Path:        []strategy.TradingPair{{InitialItem: "chaos", TargetItem: "gcp"}, {InitialItem: "gcp", TargetItem: "chaos"}},
+		GainPercent: 3,
+	}
+	alchCycle := strategy.Opportunity{
+		StartItem:   "chaos",
+		Path:        []strategy.TradingPair{{InitialItem: "chaos", TargetItem: "alch"}, {InitialItem: "alch", TargetItem: "chaos"}},
+		GainPercent: 2,
+	}
+	previous := map[string]strategy.Opportunity{
+		exaltedCycle.CycleKey(): exaltedCycle,
+		gcpCycle.CycleKey():     gcpCycle,
+	}
+	current := map[string]strategy.Opportunity{
+		alchCycle.CycleKey(): alchCycle,
+	}
+
+	// exalted => chaos failed so the exalted cycle is unknown rather than gone
+	carryForward(previous, current, []strategy.TradingPair{{InitialItem: "exalted", TargetItem: "chaos"}})
+	changes := diffOpportunities(previous, current, time.Now())
+
+	want := []struct {
+		change string
+		key    string
+	}{
+		{newOpportunity, alchCycle.Key()},
+		{removedOpportunity, gcpCycle.Key()},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("diffOpportunities() returned %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for i, change := range changes {
+		if change.Change != want[i].change || change.Opportunity.Key() != want[i].key {
+			t.Errorf("change %d = %s %s, want %s %s", i, change.Change, change.Opportunity.Key(), want[i].change, want[i].key)
+		}
+	}
+	if _, ok := current[exaltedCycle.CycleKey()]; !ok {
+		t.Error("exalted cycle was not carried forward to the next scan")
+	}
+}
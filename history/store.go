@@ -0,0 +1,166 @@
+package history
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/utils"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store persists order book snapshots in an embedded bbolt database. Records
+// are bucketed per league and keyed by time so that range queries are cheap.
+type Store struct {
+	db *bolt.DB
+}
+
+// Record is a snapshot of the order book of a single trading pair
+type Record struct {
+	Time   time.Time `json:"time"`
+	League string    `json:"league"`
+	Have   string    `json:"have"`
+	Want   string    `json:"want"`
+	// Lowest price (in have) paid for a single want
+	Ask float64 `json:"ask"`
+	// Highest price (in have) received for a single want via the reverse pair,
+	// 0 if the reverse pair was not fetched
+	Bid        float64           `json:"bid"`
+	Depth      int               `json:"depth"`
+	Stock      uint              `json:"stock"`
+	TotalStock uint              `json:"totalStock"`
+	Seller     string            `json:"seller"`
+	Listings   []api.TradeDetail `json:"listings"`
+}
+
+// Spread between the ask and bid, 0 if the bid is unknown
+func (r Record) Spread() float64 {
+	if r.Bid == 0 {
+		return 0
+	}
+	return r.Ask - r.Bid
+}
+
+// Open opens (or creates) the store for writing, only one process can hold it
+func Open(path string) (*Store, error) {
+	db, err := utils.OpenBolt(path, false)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// OpenReadOnly opens an existing store for reading, any number of readers can
+// hold it as long as no writer does
+func OpenReadOnly(path string) (*Store, error) {
+	db, err := utils.OpenBolt(path, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// NewRecord summarizes the sorted listings of have => want. reverseListings are
+// the sorted listings of want => have and may be nil.
+func NewRecord(
+	recordTime time.Time,
+	league, have, want string,
+	listings, reverseListings []api.TradeDetail,
+) Record {
+	record := Record{
+		Time:     recordTime,
+		League:   league,
+		Have:     have,
+		Want:     want,
+		Depth:    len(listings),
+		Listings: listings,
+	}
+	for _, listing := range listings {
+		record.TotalStock += listing.Stock
+	}
+	if len(listings) > 0 && listings[0].Ratio > 0 {
+		record.Ask = 1 / listings[0].Ratio
+		record.Stock = listings[0].Stock
+		record.Seller = listings[0].Account
+	}
+	if len(reverseListings) > 0 {
+		record.Bid = reverseListings[0].Ratio
+	}
+	return record
+}
+
+// Save stores every record in a single transaction
+func (s *Store) Save(records []Record) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, record := range records {
+			bucket, err := tx.CreateBucketIfNotExists(leagueBucket(record.League))
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(recordKey(record), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Query returns the records of league within [from, to] ordered by time
+func (s *Store) Query(league string, from, to time.Time) ([]Record, error) {
+	records := make([]Record, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(leagueBucket(league))
+		if bucket == nil {
+			return nil
+		}
+
+		return utils.ForEachInRange(bucket, from, to, func(value []byte) error {
+			var record Record
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	return records, err
+}
+
+// Prune deletes records older than before across all leagues and returns the
+// number of deleted records
+func (s *Store) Prune(before time.Time) (int, error) {
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(_ []byte, bucket *bolt.Bucket) error {
+			cursor := bucket.Cursor()
+			// Deleting via the cursor moves it to the next key
+			for key, _ := cursor.First(); key != nil && utils.KeyTime(key).Before(before); key, _ = cursor.First() {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+				deleted++
+			}
+			return nil
+		})
+	})
+	return deleted, err
+}
+
+func leagueBucket(league string) []byte {
+	return []byte("league/" + league)
+}
+
+// Keys are the big-endian timestamp followed by the trading pair which keeps
+// them sorted by time (e.g. <ts>chaos>exalted)
+func recordKey(record Record) []byte {
+	return append(utils.TimeKey(record.Time), []byte(record.Have+">"+record.Want)...)
+}
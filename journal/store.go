@@ -0,0 +1,197 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/utils"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Outcome of a whisper sent to a seller
+type Outcome string
+
+const (
+	// The trade was executed
+	Completed Outcome = "completed"
+	// The seller never responded
+	Ignored Outcome = "ignored"
+	// The seller responded but the trade fell through (e.g. sold out or
+	// changed the price)
+	Failed Outcome = "failed"
+)
+
+var whispersBucket = []byte("whispers")
+var accountsBucket = []byte("accounts")
+
+func ParseOutcome(outcome string) (Outcome, error) {
+	switch Outcome(strings.ToLower(strings.TrimSpace(outcome))) {
+	case Completed:
+		return Completed, nil
+	case Ignored:
+		return Ignored, nil
+	case Failed:
+		return Failed, nil
+	default:
+		return "", fmt.Errorf("unsupported outcome %q, expected %s, %s or %s", outcome, Completed, Ignored, Failed)
+	}
+}
+
+// Store persists the outcome of whispers and the resulting reputation of
+// every account in an embedded bbolt database
+type Store struct {
+	db *bolt.DB
+}
+
+type Whisper struct {
+	Time    time.Time `json:"time"`
+	Account string    `json:"account"`
+	Outcome Outcome   `json:"outcome"`
+	// Trading pair of the whisper, optional
+	Have string `json:"have,omitempty"`
+	Want string `json:"want,omitempty"`
+	Note string `json:"note,omitempty"`
+}
+
+// AccountStats summarizes the whispers sent to an account
+type AccountStats struct {
+	Account   string `json:"account"`
+	Whispers  int    `json:"whispers"`
+	Completed int    `json:"completed"`
+	Ignored   int    `json:"ignored"`
+	Failed    int    `json:"failed"`
+	// Whispers that were ignored or failed since the last completed trade
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	LastWhisper         time.Time `json:"lastWhisper"`
+}
+
+// ResponseRate is the share of whispers that were not ignored
+func (s AccountStats) ResponseRate() float64 {
+	if s.Whispers == 0 {
+		return 0
+	}
+	return float64(s.Whispers-s.Ignored) / float64(s.Whispers)
+}
+
+// CompletionRate is the share of whispers that ended with a trade
+func (s AccountStats) CompletionRate() float64 {
+	if s.Whispers == 0 {
+		return 0
+	}
+	return float64(s.Completed) / float64(s.Whispers)
+}
+
+func Open(path string) (*Store, error) {
+	db, err := utils.OpenBolt(path, false)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// RecordWhisper saves the whisper and returns the updated stats of its account
+func (s *Store) RecordWhisper(whisper Whisper) (AccountStats, error) {
+	var stats AccountStats
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		whispers, err := tx.CreateBucketIfNotExists(whispersBucket)
+		if err != nil {
+			return err
+		}
+		accounts, err := tx.CreateBucketIfNotExists(accountsBucket)
+		if err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(whisper)
+		if err != nil {
+			return err
+		}
+		if err := whispers.Put(whisperKey(whisper), value); err != nil {
+			return err
+		}
+
+		stats = AccountStats{Account: whisper.Account}
+		if value := accounts.Get([]byte(whisper.Account)); value != nil {
+			if err := json.Unmarshal(value, &stats); err != nil {
+				return err
+			}
+		}
+		stats.Whispers++
+		switch whisper.Outcome {
+		case Completed:
+			stats.Completed++
+			stats.ConsecutiveFailures = 0
+		case Ignored:
+			stats.Ignored++
+			stats.ConsecutiveFailures++
+		case Failed:
+			stats.Failed++
+			stats.ConsecutiveFailures++
+		}
+		if whisper.Time.After(stats.LastWhisper) {
+			stats.LastWhisper = whisper.Time
+		}
+
+		value, err = json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+		return accounts.Put([]byte(whisper.Account), value)
+	})
+	return stats, err
+}
+
+// Stats returns the stats of every account keyed by account
+func (s *Store) Stats() (map[string]AccountStats, error) {
+	stats := make(map[string]AccountStats)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		accounts := tx.Bucket(accountsBucket)
+		if accounts == nil {
+			return nil
+		}
+		return accounts.ForEach(func(key, value []byte) error {
+			var accountStats AccountStats
+			if err := json.Unmarshal(value, &accountStats); err != nil {
+				return err
+			}
+			stats[string(key)] = accountStats
+			return nil
+		})
+	})
+	return stats, err
+}
+
+// Whispers returns the whispers sent to account (or every account if empty)
+// ordered by time
+func (s *Store) Whispers(account string) ([]Whisper, error) {
+	result := make([]Whisper, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		whispers := tx.Bucket(whispersBucket)
+		if whispers == nil {
+			return nil
+		}
+		return whispers.ForEach(func(_, value []byte) error {
+			var whisper Whisper
+			if err := json.Unmarshal(value, &whisper); err != nil {
+				return err
+			}
+			if account == "" || whisper.Account == account {
+				result = append(result, whisper)
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Keys are the big-endian timestamp followed by the account
+func whisperKey(whisper Whisper) []byte {
+	return append(utils.TimeKey(whisper.Time), []byte(whisper.Account)...)
+}
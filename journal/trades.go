@@ -0,0 +1,130 @@
+package journal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/utils"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var tradesBucket = []byte("trades")
+
+// Trade is an executed trading path with the amounts actually paid and received
+type Trade struct {
+	ID   uint64     `json:"id"`
+	Time time.Time  `json:"time"`
+	Legs []TradeLeg `json:"legs"`
+	// Gains and profit (in the start item) reported when the path was
+	// suggested, nil if unknown
+	PredictedGainPercent *float64 `json:"predictedGainPercent,omitempty"`
+	PredictedProfit      *float64 `json:"predictedProfit,omitempty"`
+	// Key of the suggested opportunity the predictions were taken from, empty
+	// if they were entered by hand
+	Suggestion string `json:"suggestion,omitempty"`
+	Note       string `json:"note,omitempty"`
+}
+
+type TradeLeg struct {
+	Have     string `json:"have"`
+	Paid     uint   `json:"paid"`
+	Want     string `json:"want"`
+	Received uint   `json:"received"`
+}
+
+// Key identifies the items of the trade (e.g. chaos>exalted>chaos)
+func (t Trade) Key() string {
+	items := make([]string, 0, len(t.Legs)+1)
+	for i, leg := range t.Legs {
+		if i == 0 {
+			items = append(items, leg.Have)
+		}
+		items = append(items, leg.Want)
+	}
+	return strings.Join(items, ">")
+}
+
+func (t Trade) StartItem() string {
+	if len(t.Legs) == 0 {
+		return ""
+	}
+	return t.Legs[0].Have
+}
+
+// Profit returns the net amount gained (or lost) per item, including amounts
+// left over in intermediate items
+func (t Trade) Profit() map[string]int {
+	profit := make(map[string]int)
+	for _, leg := range t.Legs {
+		profit[leg.Have] -= int(leg.Paid)
+		profit[leg.Want] += int(leg.Received)
+	}
+	for item, amount := range profit {
+		if amount == 0 {
+			delete(profit, item)
+		}
+	}
+	return profit
+}
+
+// GainPercent is the profit in the start item relative to the amount paid in
+// the first leg, comparable to the gains predicted by the strategy. Only
+// defined if the trade ends in the start item.
+func (t Trade) GainPercent() (float64, bool) {
+	if len(t.Legs) == 0 || t.Legs[0].Paid == 0 || t.Legs[len(t.Legs)-1].Want != t.StartItem() {
+		return 0, false
+	}
+	return float64(t.Profit()[t.StartItem()]) / float64(t.Legs[0].Paid) * 100, true
+}
+
+// AddTrade saves the trade and returns it with its assigned ID
+func (s *Store) AddTrade(trade Trade) (Trade, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		trades, err := tx.CreateBucketIfNotExists(tradesBucket)
+		if err != nil {
+			return err
+		}
+		if trade.ID, err = trades.NextSequence(); err != nil {
+			return err
+		}
+		value, err := json.Marshal(trade)
+		if err != nil {
+			return err
+		}
+		return trades.Put(tradeKey(trade), value)
+	})
+	return trade, err
+}
+
+// Trades returns the trades within [from, to] ordered by time
+func (s *Store) Trades(from, to time.Time) ([]Trade, error) {
+	result := make([]Trade, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		trades := tx.Bucket(tradesBucket)
+		if trades == nil {
+			return nil
+		}
+
+		return utils.ForEachInRange(trades, from, to, func(value []byte) error {
+			var trade Trade
+			if err := json.Unmarshal(value, &trade); err != nil {
+				return err
+			}
+			result = append(result, trade)
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Keys are the big-endian timestamp followed by the ID so that trades executed
+// at the same time are kept
+func tradeKey(trade Trade) []byte {
+	key := utils.TimeKey(trade.Time)
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, trade.ID)
+	return append(key, id...)
+}
@@ -0,0 +1,163 @@
+package strategy
+
+import (
+	"math"
+)
+
+// Max number of smaller trade sizes tried per path
+const maxSizingIterations = 10
+
+// Profits within this amount are equal when sizing, the smaller size is kept
+const sizingProfitEpsilon = 1e-9
+
+// Plan is a set of opportunities that can be executed in order without
+// exceeding the capital or the stock of any listing
+type Plan struct {
+	Steps []Opportunity `json:"steps"`
+	// Net amount gained (or lost) per item once every step is executed
+	Profit            map[string]int `json:"profit"`
+	ReferenceCurrency string         `json:"referenceCurrency,omitempty"`
+	ProfitValue       float64        `json:"profitValue,omitempty"`
+	RemainingCapital  map[string]int `json:"remainingCapital"`
+}
+
+// Allocate greedily assigns the capital to the most profitable opportunity,
+// removes the stock it consumes and re-evaluates the remaining opportunities
+// until none is profitable. Every rotation of a cycle whose start item has
+// capital left is considered. Opportunities are compared by profit in the
+// reference currency if set, otherwise by profit in their start item, weighted
+// by the risk if sorting by risk-adjusted return.
+func (tp *TradingPaths) Allocate(opportunities []Opportunity) Plan {
+	plan := Plan{
+		Steps:            make([]Opportunity, 0, len(opportunities)),
+		Profit:           make(map[string]int),
+		RemainingCapital: make(map[string]int, len(tp.capital)),
+	}
+	for item, amount := range tp.capital {
+		plan.RemainingCapital[item] = amount
+	}
+	if tp.noCapitalRequirements {
+		return plan
+	}
+
+	var valuations map[string]float64
+	if tp.options.ReferenceCurrency != "" {
+		valuations = tp.Valuations(tp.options.ReferenceCurrency)
+		plan.ReferenceCurrency = tp.options.ReferenceCurrency
+	}
+
+	candidates := append([]Opportunity(nil), opportunities...)
+	consumed := make(map[string]uint)
+	for {
+		bestIndex := -1
+		var best Opportunity
+		bestScore := 0.0
+		for i, candidate := range candidates {
+			for _, tradingPath := range tp.fundedRotations(candidate.Path, plan.RemainingCapital) {
+				amount := plan.RemainingCapital[tradingPath[0].InitialItem]
+				opportunity, ok := tp.sizeTradePath(tradingPath, uint(amount), consumed)
+				if !ok || !tp.meetsThresholds(opportunity) {
+					continue
+				}
+				setValue(&opportunity, tp.options.ReferenceCurrency, valuations)
+
+				score := opportunity.Profit
+				if opportunity.ReferenceCurrency != "" {
+					score = opportunity.ProfitValue
+				}
+				if tp.options.SortByRiskAdjusted {
+					score *= 1 - opportunity.Risk
+				}
+				if bestIndex == -1 || score > bestScore {
+					bestIndex = i
+					best = opportunity
+					bestScore = score
+				}
+			}
+		}
+		if bestIndex == -1 {
+			break
+		}
+
+		for _, leg := range best.Legs {
+			for _, fill := range leg.Fills {
+				consumed[ListingKey(leg.Pair, fill.Listing)] += fill.ReceiveAmount
+			}
+			plan.RemainingCapital[leg.Pair.InitialItem] -= int(leg.PayAmount)
+			plan.RemainingCapital[leg.Pair.TargetItem] += int(leg.ReceiveAmount)
+		}
+		plan.Steps = append(plan.Steps, best)
+		plan.ProfitValue += best.ProfitValue
+		candidates = append(candidates[:bestIndex], candidates[bestIndex+1:]...)
+	}
+
+	for item, amount := range plan.RemainingCapital {
+		if profit := amount - tp.capital[item]; profit != 0 {
+			plan.Profit[item] = profit
+		}
+		if _, ok := tp.capital[item]; !ok && amount == 0 {
+			delete(plan.RemainingCapital, item)
+		}
+	}
+	return plan
+}
+
+// sizeTradePath shrinks the initial amount until every leg spends everything
+// the previous leg received (i.e. nothing is left in an intermediate item) and
+// returns the most profitable size, the smallest one on ties. Legs only trade
+// what the previous leg received, the capital of intermediate items is
+// reserved for paths starting from them.
+func (tp *TradingPaths) sizeTradePath(tradingPath []TradingPair, amount uint, consumed map[string]uint) (Opportunity, bool) {
+	var best Opportunity
+	found := false
+	for i := 0; i < maxSizingIterations && amount > 0; i++ {
+		opportunity, ok := tp.simulateTradePath(tradingPath, amount, consumed)
+		if !ok {
+			break
+		}
+		// Sizes shrink every iteration so an equal profit strands less
+		if !found || opportunity.Profit >= best.Profit-sizingProfitEpsilon {
+			best = opportunity
+			found = true
+		}
+
+		utilization := 1.0
+		for j := 1; j < len(opportunity.Legs); j++ {
+			spent := float64(opportunity.Legs[j].PayAmount) / float64(opportunity.Legs[j-1].ReceiveAmount)
+			utilization = math.Min(utilization, spent)
+		}
+		nextAmount := uint(float64(opportunity.Legs[0].PayAmount) * utilization)
+		if utilization >= 1 || nextAmount >= amount {
+			break
+		}
+		amount = nextAmount
+	}
+	return best, found
+}
+
+// fundedRotations returns the rotations of the cycle starting from items with
+// capital left
+func (tp *TradingPaths) fundedRotations(cycle []TradingPair, capital map[string]int) [][]TradingPair {
+	rotations := make([][]TradingPair, 0, len(cycle))
+	for _, pair := range cycle {
+		if capital[pair.InitialItem] > 0 {
+			rotations = append(rotations, rotateCycles([][]TradingPair{cycle}, pair.InitialItem)...)
+		}
+	}
+	return rotations
+}
+
+// meetsThresholds re-applies the gain thresholds to the profit of a sized
+// opportunity. Its gains are based on the ratios of the filled listings and
+// can exceed the profit once the size changes or amounts are left in
+// intermediate items.
+func (tp *TradingPaths) meetsThresholds(opportunity Opportunity) bool {
+	if opportunity.Profit <= 0 {
+		return false
+	}
+	profitPercent := opportunity.Profit / float64(opportunity.Legs[0].PayAmount) * 100
+	if profitPercent <= tp.options.MinGainPercent {
+		return false
+	}
+	return tp.options.MinGain <= 0 || opportunity.Profit >= tp.options.MinGain
+}
@@ -0,0 +1,128 @@
+package strategy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/t73liu/poe-arbitrage/api"
+)
+
+func TestAllocate(t *testing.T) {
+	exaltedRotation := Opportunity{
+		StartItem: "exalted",
+		Path:      []TradingPair{{"exalted", "chaos"}, {"chaos", "exalted"}},
+	}
+
+	tests := []struct {
+		name        string
+		options     Options
+		sellListing api.TradeDetail
+		wantSteps   []string
+		wantProfit  map[string]int
+	}{
+		{
+			name:        "rotation starting from capital",
+			options:     Options{MinGainPercent: 1},
+			sellListing: listing("b", 1, 12, 1000),
+			wantSteps:   []string{"chaos>exalted>chaos"},
+			wantProfit:  map[string]int{"chaos": 20},
+		},
+		{
+			// Gains are 20% - 8% but 50 chaos worth of exalted cannot be sold
+			// and the profit is only 2%
+			name:        "profit below min gain percent after sizing",
+			options:     Options{MinGainPercent: 10, LegFriction: Friction{Flat: 4}},
+			sellListing: listing("b", 1, 12, 60),
+			wantSteps:   []string{},
+			wantProfit:  map[string]int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp := newTestPaths(
+				t,
+				map[string]int{"chaos": 100},
+				tt.options,
+				book{"chaos", "exalted", []api.TradeDetail{listing("a", 10, 1, 100)}},
+				book{"exalted", "chaos", []api.TradeDetail{tt.sellListing}},
+			)
+			plan := tp.Allocate([]Opportunity{exaltedRotation})
+			if len(plan.Steps) != len(tt.wantSteps) {
+				t.Fatalf("Allocate() returned %d steps, want %d", len(plan.Steps), len(tt.wantSteps))
+			}
+			for i, step := range plan.Steps {
+				if step.Key() != tt.wantSteps[i] {
+					t.Errorf("Steps[%d] = %s, want %s", i, step.Key(), tt.wantSteps[i])
+				}
+			}
+			if len(plan.Profit) != len(tt.wantProfit) {
+				t.Errorf("Profit = %v, want %v", plan.Profit, tt.wantProfit)
+			}
+			for item, profit := range tt.wantProfit {
+				if plan.Profit[item] != profit {
+					t.Errorf("Profit[%s] = %d, want %d", item, plan.Profit[item], profit)
+				}
+			}
+		})
+	}
+}
+
+// Sizes with the same profit keep the one that leaves nothing in gcp
+func TestAllocateSizingTies(t *testing.T) {
+	tp := newTestPaths(
+		t,
+		map[string]int{"chaos": 1000},
+		Options{MinGainPercent: 1},
+		book{"chaos", "gcp", []api.TradeDetail{listing("c1", 1, 1, 300)}},
+		book{"gcp", "exalted", []api.TradeDetail{listing("e1", 120, 1, 2)}},
+		book{"exalted", "chaos", []api.TradeDetail{listing("b1", 1, 140, 1000)}},
+	)
+	plan := tp.Allocate([]Opportunity{{
+		StartItem: "chaos",
+		Path:      []TradingPair{{"chaos", "gcp"}, {"gcp", "exalted"}, {"exalted", "chaos"}},
+	}})
+	if len(plan.Steps) != 1 {
+		t.Fatalf("Allocate() returned %d steps, want 1", len(plan.Steps))
+	}
+	if payAmount := plan.Steps[0].Legs[0].PayAmount; payAmount != 240 {
+		t.Errorf("first leg pays %d chaos, want 240", payAmount)
+	}
+	if !reflect.DeepEqual(plan.Profit, map[string]int{"chaos": 40}) {
+		t.Errorf("Profit = %v, want map[chaos:40]", plan.Profit)
+	}
+}
+
+// The second opportunity only fills the stock left by the first one
+func TestAllocateSharedListing(t *testing.T) {
+	tp := newTestPaths(
+		t,
+		map[string]int{"chaos": 1000},
+		Options{MinGainPercent: 1},
+		book{"chaos", "exalted", []api.TradeDetail{listing("shared", 10, 1, 10)}},
+		// Only buys 6 exalted
+		book{"exalted", "chaos", []api.TradeDetail{listing("ec", 1, 13, 78)}},
+		book{"exalted", "gcp", []api.TradeDetail{listing("eg", 1, 55, 1000)}},
+		book{"gcp", "chaos", []api.TradeDetail{listing("gc", 5, 1, 1000)}},
+	)
+	plan := tp.Allocate([]Opportunity{
+		{StartItem: "chaos", Path: []TradingPair{{"chaos", "exalted"}, {"exalted", "chaos"}}},
+		{StartItem: "chaos", Path: []TradingPair{{"chaos", "exalted"}, {"exalted", "gcp"}, {"gcp", "chaos"}}},
+	})
+	wantSteps := []string{"chaos>exalted>chaos", "chaos>exalted>gcp>chaos"}
+	if len(plan.Steps) != len(wantSteps) {
+		t.Fatalf("Allocate() returned %d steps, want %d", len(plan.Steps), len(wantSteps))
+	}
+	wantExalted := []uint{6, 4}
+	for i, step := range plan.Steps {
+		if step.Key() != wantSteps[i] {
+			t.Errorf("Steps[%d] = %s, want %s", i, step.Key(), wantSteps[i])
+		}
+		firstLeg := step.Legs[0]
+		if firstLeg.ReceiveAmount != wantExalted[i] || firstLeg.Fills[0].Listing.Account != "shared" {
+			t.Errorf("Steps[%d] buys %d exalted from %+v, want %d from shared", i, firstLeg.ReceiveAmount, firstLeg.Fills, wantExalted[i])
+		}
+	}
+	if !reflect.DeepEqual(plan.Profit, map[string]int{"chaos": 22}) {
+		t.Errorf("Profit = %v, want map[chaos:22]", plan.Profit)
+	}
+}
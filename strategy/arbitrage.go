@@ -3,6 +3,8 @@ package strategy
 import (
 	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -16,16 +18,123 @@ type TradingPaths struct {
 	itemTradingPairs      map[string][]TradingPair
 	capital               map[string]int
 	noCapitalRequirements bool
+	options               Options
+}
+
+// Options configures how trading paths are searched and evaluated
+type Options struct {
+	Algorithm Algorithm
+	// Percentage below the best filled ratio that later listings of the same
+	// leg may be filled at
+	MaxSlippage float64
+	// Paths must gain more than this percentage after friction
+	MinGainPercent float64
+	// Paths must gain at least this amount of the starting item after
+	// friction, ignored if 0
+	MinGain float64
+	// Cost applied to every leg of a path
+	LegFriction Friction
+	// Opportunities are valued and ranked in this item if set
+	ReferenceCurrency string
+	// Max number of trades in a path, unlimited if 0
+	MaxLegs int
+	// Paths must trade every one of these items
+	MustInclude []string
+	// Paths never trade these items
+	ExcludeItems []string
+	// Number of inventory slots available in a single trade window, a window
+	// holds InventorySlots stacks of both the paid and received item.
+	// Unlimited if 0.
+	InventorySlots int
+	// Stack size of every item, items without a stack size are unlimited
+	StackSizes map[string]uint
+	// Sellers that are more likely to complete a trade
+	FavoritePlayers []string
+	// Rank opportunities by gain weighted by the probability of completing
+	// every trade
+	SortByRiskAdjusted bool
 }
 
 type TradingPair struct {
-	InitialItem string
-	TargetItem  string
+	InitialItem string `json:"initialItem"`
+	TargetItem  string `json:"targetItem"`
+}
+
+// Opportunity is a profitable trading path that starts and ends with StartItem
+type Opportunity struct {
+	StartItem    string        `json:"startItem"`
+	Path         []TradingPair `json:"path"`
+	Legs         []Leg         `json:"legs"`
+	InputAmount  uint          `json:"inputAmount"`
+	OutputAmount uint          `json:"outputAmount"`
+	GainPercent  float64       `json:"gainPercent"`
+	// Amount of StartItem gained by trading the filled amounts after friction,
+	// amounts left in intermediate items are not counted
+	Profit float64 `json:"profit"`
+	// Number of trades needed to execute every leg
+	TradeWindows uint `json:"tradeWindows"`
+	// Estimated probability that at least one trade fails
+	Risk float64 `json:"risk"`
+	// GainPercent weighted by the probability that every trade completes
+	RiskAdjustedGain float64 `json:"riskAdjustedGain"`
+	// Profit and the amount of StartItem traded in the first leg valued in
+	// ReferenceCurrency, only set if StartItem could be valued
+	ReferenceCurrency string  `json:"referenceCurrency,omitempty"`
+	ProfitValue       float64 `json:"profitValue,omitempty"`
+	CapitalValue      float64 `json:"capitalValue,omitempty"`
+}
+
+// Key identifies the trading path of the opportunity (e.g. chaos>gcp>exalted>chaos)
+func (o Opportunity) Key() string {
+	items := make([]string, 0, len(o.Path)+1)
+	items = append(items, o.StartItem)
+	for _, pair := range o.Path {
+		items = append(items, pair.TargetItem)
+	}
+	return strings.Join(items, ">")
+}
+
+// CycleKey identifies the cycle regardless of the entry point by rotating it
+// to start with the lexicographically smallest item (e.g. chaos>gcp>exalted>chaos
+// for exalted>chaos>gcp>exalted)
+func (o Opportunity) CycleKey() string {
+	start := 0
+	for i, pair := range o.Path {
+		if pair.InitialItem < o.Path[start].InitialItem {
+			start = i
+		}
+	}
+	items := make([]string, 0, len(o.Path)+1)
+	for i := range o.Path {
+		items = append(items, o.Path[(start+i)%len(o.Path)].InitialItem)
+	}
+	items = append(items, items[0])
+	return strings.Join(items, ">")
 }
 
-type validTrade struct {
-	listing api.TradeDetail
-	whisper string
+// Leg is the set of trades executed for a single TradingPair of an Opportunity
+type Leg struct {
+	Pair          TradingPair `json:"pair"`
+	Fills         []Fill      `json:"fills"`
+	PayAmount     uint        `json:"payAmount"`
+	ReceiveAmount uint        `json:"receiveAmount"`
+	// Volume-weighted ratio realized across all fills
+	Ratio float64 `json:"ratio"`
+	// Number of trade windows needed to execute every fill
+	Rounds uint `json:"rounds"`
+}
+
+// Fill is the portion of a Leg traded with a single listing
+type Fill struct {
+	Listing api.TradeDetail `json:"listing"`
+	// One whisper per round sized to fit the inventory
+	Whispers      []string `json:"whispers"`
+	PayAmount     uint     `json:"payAmount"`
+	ReceiveAmount uint     `json:"receiveAmount"`
+	// Number of trade windows needed to fit the amounts in the inventory
+	Rounds uint `json:"rounds"`
+	// Estimated probability that the seller completes the trade
+	FillProbability float64 `json:"fillProbability"`
 }
 
 type tradePathsDFS struct {
@@ -35,12 +144,16 @@ type tradePathsDFS struct {
 	result      [][]TradingPair
 }
 
-func NewTradingPaths(capital map[string]int) *TradingPaths {
+func NewTradingPaths(capital map[string]int, options Options) *TradingPaths {
+	if options.Algorithm == "" {
+		options.Algorithm = DFS
+	}
 	return &TradingPaths{
 		tradingPairTrades:     make(map[TradingPair][]api.TradeDetail),
 		itemTradingPairs:      make(map[string][]TradingPair),
 		capital:               capital,
 		noCapitalRequirements: len(capital) == 0,
+		options:               options,
 	}
 }
 
@@ -76,32 +189,125 @@ func (tp *TradingPaths) Get(initialItem, targetItem string) *[]api.TradeDetail {
 	}
 }
 
-func (tp *TradingPaths) Analyze() error {
+// TradingPairs returns every trading pair with listings sorted by item
+func (tp *TradingPaths) TradingPairs() []TradingPair {
+	tradingPairs := make([]TradingPair, 0, len(tp.tradingPairTrades))
+	for tradingPair := range tp.tradingPairTrades {
+		tradingPairs = append(tradingPairs, tradingPair)
+	}
+	sort.Slice(tradingPairs, func(i, j int) bool {
+		if tradingPairs[i].InitialItem != tradingPairs[j].InitialItem {
+			return tradingPairs[i].InitialItem < tradingPairs[j].InitialItem
+		}
+		return tradingPairs[i].TargetItem < tradingPairs[j].TargetItem
+	})
+	return tradingPairs
+}
+
+// Analyze returns the profitable trading paths starting from items with
+// capital (or any item if no capital was provided). Rotations of the same
+// cycle are reported once from their best entry point and opportunities are
+// sorted from best to worst.
+func (tp *TradingPaths) Analyze() ([]Opportunity, error) {
 	initialItems := make([]string, 0, len(tp.itemTradingPairs))
 
 	// Filter out invalid starting trades based on capital
 	for item := range tp.itemTradingPairs {
+		if tp.isExcluded(item) {
+			continue
+		}
 		if tp.noCapitalRequirements {
 			initialItems = append(initialItems, item)
 		} else if _, ok := tp.capital[item]; ok {
 			initialItems = append(initialItems, item)
 		}
 	}
+	sort.Strings(initialItems)
 
+	var negativeCycles [][]TradingPair
+	if tp.options.Algorithm == BellmanFord {
+		negativeCycles = tp.getNegativeCycles()
+	}
+
+	opportunities := make([]Opportunity, 0, len(initialItems))
 	for _, initialItem := range initialItems {
-		fmt.Println("Trades starting from:", initialItem)
-		dfs := &tradePathsDFS{
-			initialItem: initialItem,
-			visited:     make(map[string]bool),
-			currentPath: make([]TradingPair, 0, len(tp.itemTradingPairs)),
-			result:      make([][]TradingPair, 0, len(tp.itemTradingPairs)),
+		var tradingPaths [][]TradingPair
+		if tp.options.Algorithm == BellmanFord {
+			tradingPaths = rotateCycles(negativeCycles, initialItem)
+		} else {
+			dfs := &tradePathsDFS{
+				initialItem: initialItem,
+				visited:     make(map[string]bool),
+				currentPath: make([]TradingPair, 0, len(tp.itemTradingPairs)),
+				result:      make([][]TradingPair, 0, len(tp.itemTradingPairs)),
+			}
+			tp.getTradingPaths(initialItem, dfs)
+			tradingPaths = dfs.result
 		}
-		tp.getTradingPaths(initialItem, dfs)
-		for _, tradingPath := range dfs.result {
-			tp.printProfitableTradePath(tradingPath)
+		for _, tradingPath := range tradingPaths {
+			if !tp.satisfiesConstraints(tradingPath) {
+				continue
+			}
+			if opportunity, ok := tp.evaluateTradePath(tradingPath); ok {
+				opportunities = append(opportunities, opportunity)
+			}
 		}
 	}
-	return nil
+	if tp.options.ReferenceCurrency != "" {
+		tp.valueOpportunities(opportunities)
+	}
+
+	opportunities = tp.dedupeCycles(opportunities)
+	sort.Slice(opportunities, func(i, j int) bool {
+		return tp.betterOpportunity(opportunities[i], opportunities[j])
+	})
+	return opportunities, nil
+}
+
+// dedupeCycles keeps the best entry point of every cycle
+func (tp *TradingPaths) dedupeCycles(opportunities []Opportunity) []Opportunity {
+	bestIndexes := make(map[string]int, len(opportunities))
+	deduped := make([]Opportunity, 0, len(opportunities))
+	for _, opportunity := range opportunities {
+		cycleKey := opportunity.CycleKey()
+		if i, ok := bestIndexes[cycleKey]; ok {
+			if tp.betterOpportunity(opportunity, deduped[i]) {
+				deduped[i] = opportunity
+			}
+			continue
+		}
+		bestIndexes[cycleKey] = len(deduped)
+		deduped = append(deduped, opportunity)
+	}
+	return deduped
+}
+
+// betterOpportunity ranks by profit in the reference currency if valued (the
+// entry point that puts the most capital to work), otherwise entry points
+// with capital come first. Ties are ranked by gain percentage. Profit and
+// gains are weighted by the probability of completing every trade if sorting
+// by risk-adjusted return.
+func (tp *TradingPaths) betterOpportunity(a, b Opportunity) bool {
+	successA, successB := 1.0, 1.0
+	if tp.options.SortByRiskAdjusted {
+		successA, successB = 1-a.Risk, 1-b.Risk
+	}
+
+	valuedA := a.ReferenceCurrency != ""
+	valuedB := b.ReferenceCurrency != ""
+	if valuedA != valuedB {
+		return valuedA
+	}
+	if valuedA && a.ProfitValue*successA != b.ProfitValue*successB {
+		return a.ProfitValue*successA > b.ProfitValue*successB
+	}
+	if fundedA, fundedB := tp.hasCapital(a.StartItem), tp.hasCapital(b.StartItem); fundedA != fundedB {
+		return fundedA
+	}
+	if a.GainPercent*successA != b.GainPercent*successB {
+		return a.GainPercent*successA > b.GainPercent*successB
+	}
+	return a.Key() < b.Key()
 }
 
 // DFS with backtrack and visited set  (e.g. exa => gcp => chaos => exa)
@@ -113,6 +319,12 @@ func (tp *TradingPaths) getTradingPaths(item string, dfs *tradePathsDFS) {
 	} else {
 		dfs.visited[item] = true
 		for _, pair := range tp.itemTradingPairs[item] {
+			if tp.options.MaxLegs > 0 && len(dfs.currentPath) >= tp.options.MaxLegs {
+				break
+			}
+			if tp.isExcluded(pair.TargetItem) {
+				continue
+			}
 			dfs.currentPath = append(dfs.currentPath, pair)
 			tp.getTradingPaths(pair.TargetItem, dfs)
 			newPath := make([]TradingPair, len(dfs.currentPath)-1)
@@ -123,59 +335,199 @@ func (tp *TradingPaths) getTradingPaths(item string, dfs *tradePathsDFS) {
 	}
 }
 
-func (tp *TradingPaths) printProfitableTradePath(tradingPath []TradingPair) {
-	validTrades := make([]validTrade, 0, 5)
+// hasCapital reports whether paths can start from item
+func (tp *TradingPaths) hasCapital(item string) bool {
+	return tp.noCapitalRequirements || tp.capital[item] > 0
+}
+
+func (tp *TradingPaths) isExcluded(item string) bool {
+	return utils.Contains(tp.options.ExcludeItems, item)
+}
+
+// satisfiesConstraints reports whether tradingPath respects the max legs and
+// item constraints of the options
+func (tp *TradingPaths) satisfiesConstraints(tradingPath []TradingPair) bool {
+	if tp.options.MaxLegs > 0 && len(tradingPath) > tp.options.MaxLegs {
+		return false
+	}
+
+	items := make([]string, 0, len(tradingPath))
+	for _, pair := range tradingPath {
+		if tp.isExcluded(pair.InitialItem) {
+			return false
+		}
+		items = append(items, pair.InitialItem)
+	}
+	for _, item := range tp.options.MustInclude {
+		if !utils.Contains(items, item) {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluateTradePath simulates the trades along tradingPath and reports whether
+// the path is profitable
+func (tp *TradingPaths) evaluateTradePath(tradingPath []TradingPair) (Opportunity, bool) {
 	initialPair := tradingPath[0]
-	initialItem := initialPair.InitialItem
-	initialAmount := uint(tp.capital[initialItem])
+	initialAmount := uint(tp.capital[initialPair.InitialItem])
 
 	if tp.noCapitalRequirements {
 		initialTrade := tp.tradingPairTrades[initialPair][0]
 		initialAmount = initialTrade.Stock
 	}
+	return tp.simulateTradePath(tradingPath, initialAmount, nil)
+}
+
+// simulateTradePath trades initialAmount along tradingPath, every leg only
+// spends what the previous leg received (capital held in intermediate items is
+// not part of the path). consumed is the stock already taken from listings and
+// may be nil.
+func (tp *TradingPaths) simulateTradePath(
+	tradingPath []TradingPair,
+	initialAmount uint,
+	consumed map[string]uint,
+) (Opportunity, bool) {
+	legs := make([]Leg, 0, len(tradingPath))
+	initialItem := tradingPath[0].InitialItem
 	currentAmount := initialAmount
+	outputAmount := uint(0)
+	tradeWindows := uint(0)
 	hypotheticalPnL := 100.0
+	frictionMultiplier := 1 - tp.options.LegFriction.Percent/100
 
 	for _, pair := range tradingPath {
-		trades := tp.tradingPairTrades[pair]
-		noValidTrades := true
-		for _, trade := range trades {
-			if trade.PriceAmount <= currentAmount {
-				noValidTrades = false
-				maxPrice, maxItem := calcMaxTransaction(
-					trade.PriceAmount,
-					trade.ItemAmount,
-					trade.Stock,
-					currentAmount,
-				)
-				currentAmount = maxItem + uint(tp.capital[pair.TargetItem])
-				hypotheticalPnL = trade.Ratio * hypotheticalPnL
-				validTrades = append(
-					validTrades,
-					validTrade{
-						listing: trade,
-						whisper: formatWhisper(trade.Whisper, maxPrice, maxItem),
-					},
-				)
-				break
-			}
-		}
+		leg, ok := tp.fillLeg(pair, currentAmount, consumed)
 		// If a single trading pair fails then stop evaluating the rest of the cycle
-		if noValidTrades {
-			break
+		if !ok {
+			return Opportunity{}, false
 		}
+		currentAmount = leg.ReceiveAmount
+		outputAmount = leg.ReceiveAmount
+		tradeWindows += leg.Rounds
+		hypotheticalPnL = leg.Ratio * hypotheticalPnL * frictionMultiplier
+		legs = append(legs, leg)
 	}
 
-	// At least 1% gain
-	if hypotheticalPnL > 101 && len(validTrades) == len(tradingPath) {
-		fmt.Printf("%+v\n", tradingPath)
-		for _, validTrade := range validTrades {
-			fmt.Println(validTrade.whisper)
-			printTradeDetail(validTrade.listing)
+	legCount := float64(len(legs))
+	investedAmount := float64(legs[0].PayAmount)
+	flatFriction := tp.options.LegFriction.Flat * legCount
+	gainPercent := hypotheticalPnL - 100 - flatFriction/investedAmount*100
+	profit := float64(outputAmount)*math.Pow(frictionMultiplier, legCount) - tradedAmount(legs) - flatFriction
+
+	if gainPercent <= tp.options.MinGainPercent {
+		return Opportunity{}, false
+	}
+	if tp.options.MinGain > 0 && profit < tp.options.MinGain {
+		return Opportunity{}, false
+	}
+	opportunity := Opportunity{
+		StartItem:    initialItem,
+		Path:         tradingPath,
+		Legs:         legs,
+		InputAmount:  initialAmount,
+		OutputAmount: outputAmount,
+		GainPercent:  gainPercent,
+		Profit:       profit,
+		TradeWindows: tradeWindows,
+	}
+	tp.scoreRisk(&opportunity)
+	return opportunity, true
+}
+
+// tradedAmount returns the amount of the start item that reaches the last leg.
+// Amounts left in an intermediate item by a partially filled leg are not
+// traded and therefore neither gained nor lost.
+func tradedAmount(legs []Leg) float64 {
+	amount := float64(legs[0].PayAmount)
+	for i := 1; i < len(legs); i++ {
+		amount *= float64(legs[i].PayAmount) / float64(legs[i-1].ReceiveAmount)
+	}
+	return amount
+}
+
+// fillLeg spends up to amount on the listings of pair in ratio order until the
+// amount or acceptable listings run out. Stock in consumed (keyed by
+// ListingKey) is not available, consumed may be nil.
+func (tp *TradingPaths) fillLeg(pair TradingPair, amount uint, consumed map[string]uint) (Leg, bool) {
+	leg := Leg{
+		Pair:  pair,
+		Fills: make([]Fill, 0, 1),
+	}
+	remainingAmount := amount
+	minRatio := 0.0
+
+	for _, trade := range tp.tradingPairTrades[pair] {
+		if remainingAmount == 0 {
+			break
+		}
+		if len(leg.Fills) > 0 && trade.Ratio < minRatio {
+			continue
+		}
+
+		stock := trade.Stock
+		if taken := consumed[ListingKey(pair, trade)]; taken < stock {
+			stock -= taken
+		} else {
+			continue
+		}
+
+		maxPrice, maxItem := calcMaxTransaction(
+			trade.PriceAmount,
+			trade.ItemAmount,
+			stock,
+			remainingAmount,
+		)
+		if maxItem == 0 {
+			continue
 		}
-		fmt.Printf("\nGains: %.3f%% %s\n", hypotheticalPnL-100, initialItem)
+		payRounds, ok := tp.tradeRounds(pair, trade, maxPrice)
+		if !ok {
+			continue
+		}
+		whispers := make([]string, 0, len(payRounds))
+		for _, payRound := range payRounds {
+			whispers = append(whispers, formatWhisper(trade.Whisper, payRound, payRound*maxItem/maxPrice))
+		}
+		rounds := uint(len(payRounds))
+
+		if len(leg.Fills) == 0 {
+			minRatio = trade.Ratio * (1 - tp.options.MaxSlippage/100)
+		}
+		leg.Fills = append(leg.Fills, Fill{
+			Listing:       trade,
+			Whispers:      whispers,
+			PayAmount:     maxPrice,
+			ReceiveAmount: maxItem,
+			Rounds:        rounds,
+		})
+		leg.PayAmount += maxPrice
+		leg.ReceiveAmount += maxItem
+		leg.Rounds += rounds
+		remainingAmount -= maxPrice
+	}
+
+	if len(leg.Fills) == 0 {
+		return leg, false
 	}
-	fmt.Println()
+	leg.Ratio = float64(leg.ReceiveAmount) / float64(leg.PayAmount)
+	return leg, true
+}
+
+// ListingKey identifies a listing of pair across opportunities, listings
+// recorded without an ID are identified by their seller and price
+func ListingKey(pair TradingPair, trade api.TradeDetail) string {
+	if trade.ID != "" {
+		return trade.ID
+	}
+	return fmt.Sprintf(
+		"%s>%s/%s/%d/%d",
+		pair.InitialItem,
+		pair.TargetItem,
+		trade.Account,
+		trade.PriceAmount,
+		trade.ItemAmount,
+	)
 }
 
 // Assumes that capital satisfies initial price and calculates the max item amount
@@ -200,10 +552,3 @@ func formatWhisper(whisper string, priceAmount, itemAmount uint) string {
 	whisper = strings.Replace(whisper, "{1}", strconv.Itoa(int(priceAmount)), 1)
 	return whisper
 }
-
-func printTradeDetail(tradeDetail api.TradeDetail) {
-	fmt.Println("Pay:", tradeDetail.PriceAmount, tradeDetail.PriceUnit)
-	fmt.Println("Receive:", tradeDetail.ItemAmount, tradeDetail.ItemUnit)
-	fmt.Println("Stock:", tradeDetail.Stock)
-	fmt.Printf("Ratio: %.3f\n", tradeDetail.Ratio)
-}
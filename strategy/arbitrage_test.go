@@ -0,0 +1,406 @@
+package strategy
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/t73liu/poe-arbitrage/api"
+)
+
+// listing pays price of the initial item for item of the target item
+func listing(account string, price, item, stock uint) api.TradeDetail {
+	return api.TradeDetail{
+		ID:          account,
+		Account:     account,
+		Whisper:     "@" + account + " buy {0} for {1}",
+		PriceAmount: price,
+		ItemAmount:  item,
+		Stock:       stock,
+		Ratio:       float64(item) / float64(price),
+	}
+}
+
+type book struct {
+	have, want string
+	listings   []api.TradeDetail
+}
+
+func newTestPaths(t *testing.T, capital map[string]int, options Options, books ...book) *TradingPaths {
+	t.Helper()
+	tp := NewTradingPaths(capital, options)
+	for _, b := range books {
+		listings := b.listings
+		if err := tp.Set(b.have, b.want, &listings); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tp
+}
+
+func findOpportunity(opportunities []Opportunity, key string) (Opportunity, bool) {
+	for _, opportunity := range opportunities {
+		if opportunity.Key() == key {
+			return opportunity, true
+		}
+	}
+	return Opportunity{}, false
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// Capital held in intermediate items must not be counted as profit of a path
+func TestAnalyzeIgnoresIntermediateCapital(t *testing.T) {
+	tp := newTestPaths(
+		t,
+		map[string]int{"chaos": 100, "exalted": 50},
+		Options{MinGainPercent: 1},
+		book{"chaos", "exalted", []api.TradeDetail{listing("a", 10, 1, 100)}},
+		book{"exalted", "chaos", []api.TradeDetail{listing("b", 1, 12, 10000)}},
+	)
+	opportunities, err := tp.Analyze()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		key        string
+		wantInput  uint
+		wantOutput uint
+		wantProfit float64
+	}{
+		{"chaos>exalted>chaos", 100, 120, 20},
+		{"exalted>chaos>exalted", 50, 60, 10},
+	} {
+		// Only one rotation is reported, check the other directly
+		opportunity, ok := findOpportunity(opportunities, tt.key)
+		if !ok {
+			path := []TradingPair{{"chaos", "exalted"}, {"exalted", "chaos"}}
+			if tt.key == "exalted>chaos>exalted" {
+				path = []TradingPair{{"exalted", "chaos"}, {"chaos", "exalted"}}
+			}
+			if opportunity, ok = tp.evaluateTradePath(path); !ok {
+				t.Fatalf("%s is not profitable", tt.key)
+			}
+		}
+		if opportunity.Legs[0].PayAmount != tt.wantInput || opportunity.OutputAmount != tt.wantOutput {
+			t.Errorf("%s trades %d => %d, want %d => %d", tt.key, opportunity.Legs[0].PayAmount, opportunity.OutputAmount, tt.wantInput, tt.wantOutput)
+		}
+		if !almostEqual(opportunity.Profit, tt.wantProfit) {
+			t.Errorf("%s Profit = %f, want %f", tt.key, opportunity.Profit, tt.wantProfit)
+		}
+	}
+}
+
+// Amounts left in an intermediate item by a partially filled leg are not a loss
+func TestProfitIgnoresStrandedAmounts(t *testing.T) {
+	tp := newTestPaths(
+		t,
+		map[string]int{"chaos": 100},
+		Options{MinGainPercent: 1},
+		book{"chaos", "exalted", []api.TradeDetail{listing("a", 10, 1, 100)}},
+		// Only 5 of the 10 exalted can be sold
+		book{"exalted", "chaos", []api.TradeDetail{listing("b", 1, 12, 60)}},
+	)
+	opportunity, ok := tp.evaluateTradePath([]TradingPair{{"chaos", "exalted"}, {"exalted", "chaos"}})
+	if !ok {
+		t.Fatal("path is not profitable")
+	}
+	if opportunity.OutputAmount != 60 {
+		t.Errorf("OutputAmount = %d, want 60", opportunity.OutputAmount)
+	}
+	if !almostEqual(opportunity.Profit, 10) {
+		t.Errorf("Profit = %f, want 10", opportunity.Profit)
+	}
+}
+
+func TestCycleKey(t *testing.T) {
+	tests := []struct {
+		name string
+		path []TradingPair
+		want string
+	}{
+		{"already smallest", []TradingPair{{"chaos", "gcp"}, {"gcp", "exalted"}, {"exalted", "chaos"}}, "chaos>gcp>exalted>chaos"},
+		{"rotated", []TradingPair{{"exalted", "chaos"}, {"chaos", "gcp"}, {"gcp", "exalted"}}, "chaos>gcp>exalted>chaos"},
+		{"reversed direction", []TradingPair{{"exalted", "gcp"}, {"gcp", "chaos"}, {"chaos", "exalted"}}, "chaos>exalted>gcp>chaos"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opportunity := Opportunity{StartItem: tt.path[0].InitialItem, Path: tt.path}
+			if got := opportunity.CycleKey(); got != tt.want {
+				t.Errorf("CycleKey() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupeCycles(t *testing.T) {
+	chaosRotation := Opportunity{
+		StartItem:   "chaos",
+		Path:        []TradingPair{{"chaos", "exalted"}, {"exalted", "chaos"}},
+		GainPercent: 5,
+	}
+	exaltedRotation := Opportunity{
+		StartItem:   "exalted",
+		Path:        []TradingPair{{"exalted", "chaos"}, {"chaos", "exalted"}},
+		GainPercent: 8,
+	}
+	otherCycle := Opportunity{
+		StartItem:   "chaos",
+		Path:        []TradingPair{{"chaos", "gcp"}, {"gcp", "chaos"}},
+		GainPercent: 2,
+	}
+	valuedChaosRotation := chaosRotation
+	valuedChaosRotation.ReferenceCurrency = "chaos"
+	valuedChaosRotation.ProfitValue = 50
+	valuedExaltedRotation := exaltedRotation
+	valuedExaltedRotation.ReferenceCurrency = "chaos"
+	valuedExaltedRotation.ProfitValue = 20
+
+	tests := []struct {
+		name          string
+		capital       map[string]int
+		opportunities []Opportunity
+		want          []string
+	}{
+		{
+			name:          "highest gain without capital",
+			opportunities: []Opportunity{chaosRotation, otherCycle, exaltedRotation},
+			want:          []string{"exalted>chaos>exalted", "chaos>gcp>chaos"},
+		},
+		{
+			name:          "funded rotation",
+			capital:       map[string]int{"chaos": 100, "exalted": 0},
+			opportunities: []Opportunity{exaltedRotation, chaosRotation},
+			want:          []string{"chaos>exalted>chaos"},
+		},
+		{
+			name:          "highest reference profit",
+			capital:       map[string]int{"chaos": 100, "exalted": 10},
+			opportunities: []Opportunity{valuedExaltedRotation, valuedChaosRotation},
+			want:          []string{"chaos>exalted>chaos"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp := NewTradingPaths(tt.capital, Options{})
+			deduped := tp.dedupeCycles(tt.opportunities)
+			if len(deduped) != len(tt.want) {
+				t.Fatalf("dedupeCycles() returned %d opportunities, want %d", len(deduped), len(tt.want))
+			}
+			for i, opportunity := range deduped {
+				if opportunity.Key() != tt.want[i] {
+					t.Errorf("dedupeCycles()[%d] = %s, want %s", i, opportunity.Key(), tt.want[i])
+				}
+			}
+		})
+	}
+}
+func TestCalcMaxTransaction(t *testing.T) {
+	tests := []struct {
+		name                string
+		price, item, stock  uint
+		capital             uint
+		wantPrice, wantItem uint
+	}{
+		{"limited by capital", 10, 1, 100, 35, 30, 3},
+		{"limited by stock", 10, 1, 2, 100, 20, 2},
+		{"reduced lot", 150, 10, 100, 45, 45, 3},
+		{"lot larger than capital", 150, 10, 100, 14, 0, 0},
+		{"lot larger than stock", 3, 2, 1, 100, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPrice, gotItem := calcMaxTransaction(tt.price, tt.item, tt.stock, tt.capital)
+			if gotPrice != tt.wantPrice || gotItem != tt.wantItem {
+				t.Errorf("calcMaxTransaction() = (%d, %d), want (%d, %d)", gotPrice, gotItem, tt.wantPrice, tt.wantItem)
+			}
+		})
+	}
+}
+
+func TestEvaluateTradePath(t *testing.T) {
+	tests := []struct {
+		name       string
+		books      []book
+		wantOK     bool
+		wantGain   float64
+		wantProfit float64
+	}{
+		{
+			name: "profitable",
+			books: []book{
+				{"chaos", "exalted", []api.TradeDetail{listing("a", 10, 1, 100)}},
+				{"exalted", "chaos", []api.TradeDetail{listing("b", 1, 12, 1000)}},
+			},
+			wantOK:     true,
+			wantGain:   20,
+			wantProfit: 20,
+		},
+		{
+			name: "below min gain",
+			books: []book{
+				{"chaos", "exalted", []api.TradeDetail{listing("a", 10, 1, 100)}},
+				{"exalted", "chaos", []api.TradeDetail{listing("b", 1, 10, 1000)}},
+			},
+			wantOK: false,
+		},
+		{
+			name: "no listing fits the capital",
+			books: []book{
+				{"chaos", "exalted", []api.TradeDetail{listing("a", 200, 1, 100)}},
+				{"exalted", "chaos", []api.TradeDetail{listing("b", 1, 300, 1000)}},
+			},
+			wantOK: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp := newTestPaths(t, map[string]int{"chaos": 100}, Options{MinGainPercent: 1}, tt.books...)
+			path := []TradingPair{{"chaos", "exalted"}, {"exalted", "chaos"}}
+			opportunity, ok := tp.evaluateTradePath(path)
+			if ok != tt.wantOK {
+				t.Fatalf("evaluateTradePath() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if !almostEqual(opportunity.GainPercent, tt.wantGain) {
+				t.Errorf("GainPercent = %f, want %f", opportunity.GainPercent, tt.wantGain)
+			}
+			if !almostEqual(opportunity.Profit, tt.wantProfit) {
+				t.Errorf("Profit = %f, want %f", opportunity.Profit, tt.wantProfit)
+			}
+		})
+	}
+}
+
+func TestFillLeg(t *testing.T) {
+	pair := TradingPair{"chaos", "exalted"}
+	tests := []struct {
+		name        string
+		listings    []api.TradeDetail
+		maxSlippage float64
+		consumed    map[string]uint
+		wantOK      bool
+		wantPay     uint
+		wantReceive uint
+		wantFills   []string
+	}{
+		{
+			name:        "single listing",
+			listings:    []api.TradeDetail{listing("a", 10, 1, 100), listing("b", 11, 1, 100)},
+			wantOK:      true,
+			wantPay:     100,
+			wantReceive: 10,
+			wantFills:   []string{"a"},
+		},
+		{
+			name:        "spills into the next listing",
+			listings:    []api.TradeDetail{listing("a", 10, 1, 3), listing("b", 11, 1, 100)},
+			maxSlippage: 20,
+			wantOK:      true,
+			wantPay:     96,
+			wantReceive: 9,
+			wantFills:   []string{"a", "b"},
+		},
+		{
+			name:        "listings beyond the slippage are skipped",
+			listings:    []api.TradeDetail{listing("a", 10, 1, 3), listing("c", 12, 1, 100), listing("b", 15, 1, 100)},
+			maxSlippage: 20,
+			wantOK:      true,
+			wantPay:     90,
+			wantReceive: 8,
+			wantFills:   []string{"a", "c"},
+		},
+		{
+			name:        "consumed stock",
+			listings:    []api.TradeDetail{listing("a", 10, 1, 3), listing("b", 11, 1, 100)},
+			consumed:    map[string]uint{"a": 3},
+			wantOK:      true,
+			wantPay:     99,
+			wantReceive: 9,
+			wantFills:   []string{"b"},
+		},
+		{
+			name:     "no listing fits the amount",
+			listings: []api.TradeDetail{listing("a", 200, 1, 100)},
+			wantOK:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp := newTestPaths(t, nil, Options{MaxSlippage: tt.maxSlippage}, book{"chaos", "exalted", tt.listings})
+			leg, ok := tp.fillLeg(pair, 100, tt.consumed)
+			if ok != tt.wantOK {
+				t.Fatalf("fillLeg() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if leg.PayAmount != tt.wantPay || leg.ReceiveAmount != tt.wantReceive {
+				t.Errorf("fillLeg() trades %d => %d, want %d => %d", leg.PayAmount, leg.ReceiveAmount, tt.wantPay, tt.wantReceive)
+			}
+			fills := make([]string, 0, len(leg.Fills))
+			for _, fill := range leg.Fills {
+				fills = append(fills, fill.Listing.Account)
+			}
+			if !reflect.DeepEqual(fills, tt.wantFills) {
+				t.Errorf("fillLeg() fills = %v, want %v", fills, tt.wantFills)
+			}
+			if !almostEqual(leg.Ratio, float64(tt.wantReceive)/float64(tt.wantPay)) {
+				t.Errorf("Ratio = %f, want %f", leg.Ratio, float64(tt.wantReceive)/float64(tt.wantPay))
+			}
+		})
+	}
+}
+
+func TestAnalyzeConstraints(t *testing.T) {
+	books := []book{
+		// chaos>alch>chaos gains 10%
+		{"chaos", "alch", []api.TradeDetail{listing("a", 1, 1, 1000)}},
+		{"alch", "chaos", []api.TradeDetail{listing("b", 10, 11, 10000)}},
+		// chaos>gcp>exalted>chaos gains 10%
+		{"chaos", "gcp", []api.TradeDetail{listing("c", 1, 1, 1000)}},
+		{"gcp", "exalted", []api.TradeDetail{listing("d", 10, 1, 100)}},
+		{"exalted", "chaos", []api.TradeDetail{listing("e", 1, 11, 10000)}},
+	}
+	twoLegs := "alch>chaos>alch"
+	threeLegs := "chaos>gcp>exalted>chaos"
+	tests := []struct {
+		name    string
+		options Options
+		want    []string
+	}{
+		{"unlimited legs", Options{}, []string{twoLegs, threeLegs}},
+		{"max legs", Options{MaxLegs: 2}, []string{twoLegs}},
+		{"max legs equal to the cycle", Options{MaxLegs: 3}, []string{twoLegs, threeLegs}},
+		{"must include", Options{MustInclude: []string{"gcp"}}, []string{threeLegs}},
+		{"excluded items", Options{ExcludeItems: []string{"exalted"}}, []string{twoLegs}},
+	}
+	for _, algorithm := range []Algorithm{DFS, BellmanFord} {
+		for _, tt := range tests {
+			t.Run(string(algorithm)+"/"+tt.name, func(t *testing.T) {
+				options := tt.options
+				options.Algorithm = algorithm
+				options.MinGainPercent = 1
+				tp := newTestPaths(t, nil, options, books...)
+				opportunities, err := tp.Analyze()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := make([]string, 0, len(opportunities))
+				for _, opportunity := range opportunities {
+					got = append(got, opportunity.CycleKey())
+				}
+				sort.Strings(got)
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Analyze() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
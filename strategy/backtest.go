@@ -0,0 +1,172 @@
+package strategy
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/t73liu/poe-arbitrage/api"
+)
+
+// Snapshot is the state of every trading pair at a point in time
+type Snapshot struct {
+	Time         time.Time
+	TradingPaths *TradingPaths
+}
+
+type BacktestOptions struct {
+	// Probability that a seller accepts a single whisper
+	FillProbability float64
+	// Time between detecting an opportunity and executing it. Listings must
+	// still be available in the first snapshot after the latency.
+	Latency time.Duration
+	Seed    int64
+}
+
+// BacktestResult summarizes the simulated executions of a single trading path.
+// Amounts are in StartItem.
+type BacktestResult struct {
+	Key         string  `json:"key"`
+	StartItem   string  `json:"startItem"`
+	Detections  int     `json:"detections"`
+	Hits        int     `json:"hits"`
+	HitRate     float64 `json:"hitRate"`
+	PnL         float64 `json:"pnl"`
+	MaxDrawdown float64 `json:"maxDrawdown"`
+	peakPnL     float64
+}
+
+// Backtest analyzes every snapshot and simulates executing the detected
+// opportunities against the snapshot available after the latency. A failed
+// fill leaves the amounts held in intermediate items which are sold back to
+// the start item at the best available ratio.
+func Backtest(snapshots []Snapshot, options BacktestOptions) ([]BacktestResult, error) {
+	if options.FillProbability < 0 || options.FillProbability > 1 {
+		return nil, errors.New("fill probability must be between 0 and 1")
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+
+	random := rand.New(rand.NewSource(options.Seed))
+	results := make(map[string]*BacktestResult)
+	for i, snapshot := range snapshots {
+		execution := findExecutionSnapshot(snapshots[i:], snapshot.Time.Add(options.Latency))
+		if execution == nil {
+			break
+		}
+
+		opportunities, err := snapshot.TradingPaths.Analyze()
+		if err != nil {
+			return nil, err
+		}
+		for _, opportunity := range opportunities {
+			key := opportunity.Key()
+			result, ok := results[key]
+			if !ok {
+				result = &BacktestResult{
+					Key:       key,
+					StartItem: opportunity.StartItem,
+				}
+				results[key] = result
+			}
+
+			pnl, hit := simulateExecution(opportunity, execution.TradingPaths, options.FillProbability, random)
+			result.Detections++
+			if hit {
+				result.Hits++
+			}
+			result.PnL += pnl
+			if result.PnL > result.peakPnL {
+				result.peakPnL = result.PnL
+			}
+			if drawdown := result.peakPnL - result.PnL; drawdown > result.MaxDrawdown {
+				result.MaxDrawdown = drawdown
+			}
+		}
+	}
+
+	sortedResults := make([]BacktestResult, 0, len(results))
+	for _, result := range results {
+		result.HitRate = float64(result.Hits) / float64(result.Detections)
+		sortedResults = append(sortedResults, *result)
+	}
+	sort.Slice(sortedResults, func(i, j int) bool {
+		return sortedResults[i].Key < sortedResults[j].Key
+	})
+	return sortedResults, nil
+}
+
+// Returns the first snapshot at or after executionTime
+func findExecutionSnapshot(snapshots []Snapshot, executionTime time.Time) *Snapshot {
+	for i := range snapshots {
+		if !snapshots[i].Time.Before(executionTime) {
+			return &snapshots[i]
+		}
+	}
+	return nil
+}
+
+// simulateExecution returns the PnL (in the start item) of executing the fills
+// of opportunity in order against the listings of execution. Every item held
+// once a fill fails (or left over after the last leg) is sold back to the start
+// item at the best available ratio.
+func simulateExecution(
+	opportunity Opportunity,
+	execution *TradingPaths,
+	fillProbability float64,
+	random *rand.Rand,
+) (pnl float64, hit bool) {
+	startItem := opportunity.StartItem
+	invested := float64(opportunity.Legs[0].PayAmount)
+	holdings := map[string]float64{startItem: invested}
+
+	hit = true
+	for _, leg := range opportunity.Legs {
+		for _, fill := range leg.Fills {
+			available := execution.hasListing(leg.Pair, fill.Listing, fill.ReceiveAmount)
+			if !available || random.Float64() >= fillProbability {
+				hit = false
+				break
+			}
+			holdings[leg.Pair.InitialItem] -= float64(fill.PayAmount)
+			holdings[leg.Pair.TargetItem] += float64(fill.ReceiveAmount)
+		}
+		if !hit {
+			break
+		}
+	}
+
+	value := holdings[startItem]
+	for _, leg := range opportunity.Legs[1:] {
+		if amount := holdings[leg.Pair.InitialItem]; amount > 0 {
+			value += amount * execution.bestRatio(leg.Pair.InitialItem, startItem)
+		}
+	}
+	return value - invested, hit
+}
+
+// Reports whether a listing from the same seller at the same or better ratio
+// still has enough stock
+func (tp *TradingPaths) hasListing(pair TradingPair, listing api.TradeDetail, amount uint) bool {
+	for _, trade := range tp.tradingPairTrades[pair] {
+		if trade.Account == listing.Account && trade.Ratio >= listing.Ratio*(1-relaxEpsilon) && trade.Stock >= amount {
+			return true
+		}
+	}
+	return false
+}
+
+// Best ratio of initialItem => targetItem, 0 if there are no listings
+func (tp *TradingPaths) bestRatio(initialItem, targetItem string) float64 {
+	bestRatio := 0.0
+	pair := TradingPair{InitialItem: initialItem, TargetItem: targetItem}
+	for _, trade := range tp.tradingPairTrades[pair] {
+		if trade.Ratio > bestRatio {
+			bestRatio = trade.Ratio
+		}
+	}
+	return bestRatio
+}
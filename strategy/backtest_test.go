@@ -0,0 +1,81 @@
+package strategy
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/t73liu/poe-arbitrage/api"
+)
+
+func TestSimulateExecution(t *testing.T) {
+	buyListings := []api.TradeDetail{listing("a", 10, 1, 4), listing("b", 11, 1, 100)}
+	sellListings := []api.TradeDetail{listing("c", 1, 13, 1000)}
+	detection := newTestPaths(
+		t,
+		map[string]int{"chaos": 100},
+		Options{MinGainPercent: 1, MaxSlippage: 20},
+		book{"chaos", "exalted", buyListings},
+		book{"exalted", "chaos", sellListings},
+	)
+	// 40 chaos => 4 exalted (a), 55 chaos => 5 exalted (b), 9 exalted => 117 chaos (c)
+	opportunity, ok := detection.evaluateTradePath([]TradingPair{{"chaos", "exalted"}, {"exalted", "chaos"}})
+	if !ok {
+		t.Fatal("path is not profitable")
+	}
+
+	tests := []struct {
+		name            string
+		buyListings     []api.TradeDetail
+		sellListings    []api.TradeDetail
+		fillProbability float64
+		wantPnL         float64
+		wantHit         bool
+	}{
+		{
+			name:            "every fill completes",
+			buyListings:     buyListings,
+			sellListings:    sellListings,
+			fillProbability: 1,
+			wantPnL:         117 - 95,
+			wantHit:         true,
+		},
+		{
+			name:            "first whisper ignored",
+			buyListings:     buyListings,
+			sellListings:    sellListings,
+			fillProbability: 0,
+			wantPnL:         0,
+		},
+		{
+			// Only the 55 chaos of b are left unspent and the 4 exalted from a
+			// are sold back
+			name:            "second fill of the first leg gone",
+			buyListings:     buyListings[:1],
+			sellListings:    sellListings,
+			fillProbability: 1,
+			wantPnL:         55 + 4*13 - 95,
+		},
+		{
+			name:            "last leg gone",
+			buyListings:     buyListings,
+			sellListings:    []api.TradeDetail{listing("d", 1, 12, 1000)},
+			fillProbability: 1,
+			wantPnL:         9*12 - 95,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			execution := newTestPaths(
+				t,
+				map[string]int{"chaos": 100},
+				Options{},
+				book{"chaos", "exalted", tt.buyListings},
+				book{"exalted", "chaos", tt.sellListings},
+			)
+			pnl, hit := simulateExecution(opportunity, execution, tt.fillProbability, rand.New(rand.NewSource(1)))
+			if !almostEqual(pnl, tt.wantPnL) || hit != tt.wantHit {
+				t.Errorf("simulateExecution() = (%f, %v), want (%f, %v)", pnl, hit, tt.wantPnL, tt.wantHit)
+			}
+		})
+	}
+}
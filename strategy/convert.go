@@ -0,0 +1,105 @@
+package strategy
+
+import (
+	"strings"
+)
+
+// Route converts an amount of From into To through zero or more intermediate
+// items
+type Route struct {
+	From         string        `json:"from"`
+	To           string        `json:"to"`
+	Path         []TradingPair `json:"path"`
+	Legs         []Leg         `json:"legs"`
+	InputAmount  uint          `json:"inputAmount"`
+	OutputAmount uint          `json:"outputAmount"`
+	TradeWindows uint          `json:"tradeWindows"`
+	// Amounts that could not be traded due to stock or lot sizes
+	Leftovers map[string]uint `json:"leftovers,omitempty"`
+}
+
+// Key identifies the items of the route (e.g. chaos>gcp>exalted)
+func (r Route) Key() string {
+	items := make([]string, 0, len(r.Path)+1)
+	items = append(items, r.From)
+	for _, pair := range r.Path {
+		items = append(items, pair.TargetItem)
+	}
+	return strings.Join(items, ">")
+}
+
+// BestRoute returns the route that converts amount of from into the most to.
+// Every simple path within the max legs and item constraints is simulated with
+// the same fills as Analyze. Ties prefer fewer trade windows, then fewer legs.
+func (tp *TradingPaths) BestRoute(from, to string, amount uint) (Route, bool) {
+	var best Route
+	found := false
+
+	visited := map[string]bool{from: true}
+	path := make([]TradingPair, 0, len(tp.itemTradingPairs))
+	var search func(item string)
+	search = func(item string) {
+		if item == to {
+			route, ok := tp.simulateRoute(from, to, path, amount)
+			if ok && (!found || betterRoute(route, best)) {
+				best = route
+				found = true
+			}
+			return
+		}
+		if tp.options.MaxLegs > 0 && len(path) >= tp.options.MaxLegs {
+			return
+		}
+		for _, pair := range tp.itemTradingPairs[item] {
+			if visited[pair.TargetItem] || tp.isExcluded(pair.TargetItem) {
+				continue
+			}
+			visited[pair.TargetItem] = true
+			path = append(path, pair)
+			search(pair.TargetItem)
+			path = path[:len(path)-1]
+			visited[pair.TargetItem] = false
+		}
+	}
+	search(from)
+	return best, found
+}
+
+func (tp *TradingPaths) simulateRoute(from, to string, path []TradingPair, amount uint) (Route, bool) {
+	route := Route{
+		From:      from,
+		To:        to,
+		Path:      append([]TradingPair(nil), path...),
+		Legs:      make([]Leg, 0, len(path)),
+		Leftovers: make(map[string]uint),
+	}
+	currentAmount := amount
+	for _, pair := range path {
+		leg, ok := tp.fillLeg(pair, currentAmount, nil)
+		if !ok {
+			return Route{}, false
+		}
+		if leftover := currentAmount - leg.PayAmount; leftover > 0 {
+			route.Leftovers[pair.InitialItem] = leftover
+		}
+		currentAmount = leg.ReceiveAmount
+		route.TradeWindows += leg.Rounds
+		route.Legs = append(route.Legs, leg)
+	}
+	route.InputAmount = route.Legs[0].PayAmount
+	route.OutputAmount = currentAmount
+	return route, true
+}
+
+func betterRoute(a, b Route) bool {
+	if a.OutputAmount != b.OutputAmount {
+		return a.OutputAmount > b.OutputAmount
+	}
+	if a.TradeWindows != b.TradeWindows {
+		return a.TradeWindows < b.TradeWindows
+	}
+	if len(a.Path) != len(b.Path) {
+		return len(a.Path) < len(b.Path)
+	}
+	return a.Key() < b.Key()
+}
@@ -0,0 +1,53 @@
+package strategy
+
+import (
+	"testing"
+
+	"github.com/t73liu/poe-arbitrage/api"
+)
+
+func TestBestRoute(t *testing.T) {
+	direct := book{"chaos", "gcp", []api.TradeDetail{listing("cg", 1, 2, 1000)}}
+	chaosExalted := book{"chaos", "exalted", []api.TradeDetail{listing("ce", 100, 1, 10)}}
+	worseExaltedGCP := book{"exalted", "gcp", []api.TradeDetail{listing("eg", 1, 150, 1000)}}
+	betterExaltedGCP := book{"exalted", "gcp", []api.TradeDetail{listing("eg", 1, 250, 1000)}}
+
+	tests := []struct {
+		name    string
+		options Options
+		books   []book
+		key     string
+		output  uint
+	}{
+		{"direct beats intermediate", Options{}, []book{direct, chaosExalted, worseExaltedGCP}, "chaos>gcp", 200},
+		{"intermediate wins", Options{}, []book{direct, chaosExalted, betterExaltedGCP}, "chaos>exalted>gcp", 250},
+		{"max legs", Options{MaxLegs: 1}, []book{direct, chaosExalted, betterExaltedGCP}, "chaos>gcp", 200},
+		{
+			"excluded intermediate",
+			Options{ExcludeItems: []string{"exalted"}},
+			[]book{direct, chaosExalted, betterExaltedGCP},
+			"chaos>gcp",
+			200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp := newTestPaths(t, nil, tt.options, tt.books...)
+			route, ok := tp.BestRoute("chaos", "gcp", 100)
+			if !ok {
+				t.Fatal("BestRoute() found no route")
+			}
+			if route.Key() != tt.key || route.OutputAmount != tt.output {
+				t.Errorf("BestRoute() = %s => %d, want %s => %d", route.Key(), route.OutputAmount, tt.key, tt.output)
+			}
+			if route.InputAmount != 100 {
+				t.Errorf("InputAmount = %d, want 100", route.InputAmount)
+			}
+		})
+	}
+
+	tp := newTestPaths(t, nil, Options{MaxLegs: 1}, chaosExalted, betterExaltedGCP)
+	if route, ok := tp.BestRoute("chaos", "gcp", 100); ok {
+		t.Errorf("BestRoute() = %s, want no route within 1 leg", route.Key())
+	}
+}
@@ -0,0 +1,164 @@
+package strategy
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+type Algorithm string
+
+const (
+	// DFS enumerates every simple cycle which is only practical for ~8 items
+	DFS Algorithm = "dfs"
+	// BellmanFord searches for negative cycles in a graph weighted by
+	// -log(ratio) which scales to dozens of items
+	BellmanFord Algorithm = "bellman-ford"
+)
+
+// Upper bound on the number of cycles returned by a negative-cycle search
+const maxNegativeCycles = 100
+
+// Relaxations smaller than this are treated as floating point noise
+const relaxEpsilon = 1e-12
+
+func ParseAlgorithm(algorithm string) (Algorithm, error) {
+	switch Algorithm(strings.ToLower(strings.TrimSpace(algorithm))) {
+	case DFS:
+		return DFS, nil
+	case BellmanFord:
+		return BellmanFord, nil
+	default:
+		return "", fmt.Errorf("unsupported algorithm %q, expected %s or %s", algorithm, DFS, BellmanFord)
+	}
+}
+
+type weightedEdge struct {
+	pair   TradingPair
+	weight float64
+}
+
+// getNegativeCycles finds profitable cycles with Bellman-Ford using the best
+// listing of every trading pair. The least profitable edge of every cycle found
+// is removed so that the next search can surface a different cycle. Excluded
+// items are removed from the graph, the remaining constraints can only be
+// checked once a cycle is found.
+func (tp *TradingPaths) getNegativeCycles() [][]TradingPair {
+	items := make(map[string]bool)
+	edges := make([]weightedEdge, 0, len(tp.tradingPairTrades))
+	for pair, trades := range tp.tradingPairTrades {
+		if tp.isExcluded(pair.InitialItem) || tp.isExcluded(pair.TargetItem) {
+			continue
+		}
+		bestRatio := 0.0
+		for _, trade := range trades {
+			bestRatio = math.Max(bestRatio, trade.Ratio)
+		}
+		if bestRatio <= 0 {
+			continue
+		}
+		items[pair.InitialItem] = true
+		items[pair.TargetItem] = true
+		edges = append(edges, weightedEdge{pair: pair, weight: -math.Log(bestRatio)})
+	}
+	// Map iteration is random, sort to keep the search deterministic
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].pair.InitialItem != edges[j].pair.InitialItem {
+			return edges[i].pair.InitialItem < edges[j].pair.InitialItem
+		}
+		return edges[i].pair.TargetItem < edges[j].pair.TargetItem
+	})
+
+	cycles := make([][]TradingPair, 0, len(items))
+	for len(cycles) < maxNegativeCycles {
+		cycle := findNegativeCycle(len(items), edges)
+		if cycle == nil {
+			break
+		}
+		cycles = append(cycles, cycle)
+
+		worstIndex := -1
+		for i, edge := range edges {
+			if !containsPair(cycle, edge.pair) {
+				continue
+			}
+			if worstIndex == -1 || edge.weight > edges[worstIndex].weight {
+				worstIndex = i
+			}
+		}
+		edges = append(edges[:worstIndex], edges[worstIndex+1:]...)
+	}
+	return cycles
+}
+
+// Bellman-Ford from a virtual source connected to every item, returns nil if
+// there are no negative cycles
+func findNegativeCycle(numItems int, edges []weightedEdge) []TradingPair {
+	distances := make(map[string]float64, numItems)
+	predecessors := make(map[string]TradingPair, numItems)
+
+	relaxedItem := ""
+	for i := 0; i < numItems; i++ {
+		relaxedItem = ""
+		for _, edge := range edges {
+			distance := distances[edge.pair.InitialItem] + edge.weight
+			if distance < distances[edge.pair.TargetItem]-relaxEpsilon {
+				distances[edge.pair.TargetItem] = distance
+				predecessors[edge.pair.TargetItem] = edge.pair
+				relaxedItem = edge.pair.TargetItem
+			}
+		}
+		if relaxedItem == "" {
+			return nil
+		}
+	}
+
+	// Walk back numItems times to guarantee that the item is on the cycle
+	item := relaxedItem
+	for i := 0; i < numItems; i++ {
+		item = predecessors[item].InitialItem
+	}
+
+	cycle := make([]TradingPair, 0, numItems)
+	for current := item; ; {
+		pair := predecessors[current]
+		cycle = append(cycle, pair)
+		current = pair.InitialItem
+		if current == item {
+			break
+		}
+	}
+
+	// Predecessors were followed backwards
+	for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+		cycle[i], cycle[j] = cycle[j], cycle[i]
+	}
+	return cycle
+}
+
+// Rotates every cycle containing initialItem so that it starts from it
+func rotateCycles(cycles [][]TradingPair, initialItem string) [][]TradingPair {
+	result := make([][]TradingPair, 0, len(cycles))
+	for _, cycle := range cycles {
+		for i, pair := range cycle {
+			if pair.InitialItem == initialItem {
+				rotated := make([]TradingPair, 0, len(cycle))
+				rotated = append(rotated, cycle[i:]...)
+				rotated = append(rotated, cycle[:i]...)
+				result = append(result, rotated)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func containsPair(path []TradingPair, pair TradingPair) bool {
+	for _, el := range path {
+		if el == pair {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package strategy
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/t73liu/poe-arbitrage/api"
+)
+
+func ratioEdge(have, want string, ratio float64) weightedEdge {
+	return weightedEdge{pair: TradingPair{have, want}, weight: -math.Log(ratio)}
+}
+
+// cycleKeys normalizes the rotation of every cycle and sorts them
+func cycleKeys(cycles [][]TradingPair) []string {
+	keys := make([]string, 0, len(cycles))
+	for _, cycle := range cycles {
+		keys = append(keys, Opportunity{StartItem: cycle[0].InitialItem, Path: cycle}.CycleKey())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Algorithm
+		wantErr bool
+	}{
+		{"dfs", DFS, false},
+		{" Bellman-Ford ", BellmanFord, false},
+		{"dijkstra", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAlgorithm(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseAlgorithm(%q) = %q, %v", tt.value, got, err)
+		}
+	}
+}
+
+func TestFindNegativeCycle(t *testing.T) {
+	tests := []struct {
+		name     string
+		numItems int
+		edges    []weightedEdge
+		want     []string
+	}{
+		{
+			"no profitable cycle",
+			2,
+			[]weightedEdge{ratioEdge("chaos", "exalted", 0.1), ratioEdge("exalted", "chaos", 9.5)},
+			[]string{},
+		},
+		{
+			"break even is not a cycle",
+			2,
+			[]weightedEdge{ratioEdge("chaos", "exalted", 0.1), ratioEdge("exalted", "chaos", 10)},
+			[]string{},
+		},
+		{
+			"two items",
+			2,
+			[]weightedEdge{ratioEdge("chaos", "exalted", 0.1), ratioEdge("exalted", "chaos", 12)},
+			[]string{"chaos>exalted>chaos"},
+		},
+		{
+			"three items with a losing edge",
+			3,
+			[]weightedEdge{
+				ratioEdge("chaos", "gcp", 1),
+				ratioEdge("exalted", "chaos", 11),
+				ratioEdge("exalted", "gcp", 5),
+				ratioEdge("gcp", "chaos", 0.9),
+				ratioEdge("gcp", "exalted", 0.1),
+			},
+			[]string{"chaos>gcp>exalted>chaos"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cycles [][]TradingPair
+			if cycle := findNegativeCycle(tt.numItems, tt.edges); cycle != nil {
+				cycles = append(cycles, cycle)
+			}
+			if got := cycleKeys(cycles); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findNegativeCycle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetNegativeCycles(t *testing.T) {
+	books := []book{
+		{"chaos", "exalted", []api.TradeDetail{listing("a", 10, 1, 100)}},
+		{"exalted", "chaos", []api.TradeDetail{listing("b", 1, 12, 1000)}},
+		{"chaos", "gcp", []api.TradeDetail{listing("c", 1, 1, 1000)}},
+		{"gcp", "chaos", []api.TradeDetail{listing("d", 10, 11, 1000)}},
+		// Trading exalted for gcp loses half of the value
+		{"exalted", "gcp", []api.TradeDetail{listing("e", 1, 5, 1000)}},
+		{"gcp", "exalted", []api.TradeDetail{listing("f", 20, 1, 100)}},
+	}
+	tests := []struct {
+		name    string
+		options Options
+		want    []string
+	}{
+		{"every cycle", Options{}, []string{"chaos>exalted>chaos", "chaos>gcp>chaos"}},
+		{"excluded items", Options{ExcludeItems: []string{"gcp"}}, []string{"chaos>exalted>chaos"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp := newTestPaths(t, nil, tt.options, books...)
+			if got := cycleKeys(tp.getNegativeCycles()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getNegativeCycles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotateCycles(t *testing.T) {
+	cycles := [][]TradingPair{
+		{{"chaos", "gcp"}, {"gcp", "exalted"}, {"exalted", "chaos"}},
+		{{"chaos", "alch"}, {"alch", "chaos"}},
+	}
+	want := [][]TradingPair{
+		{{"exalted", "chaos"}, {"chaos", "gcp"}, {"gcp", "exalted"}},
+	}
+	if got := rotateCycles(cycles, "exalted"); !reflect.DeepEqual(got, want) {
+		t.Errorf("rotateCycles() = %v, want %v", got, want)
+	}
+}
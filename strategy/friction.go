@@ -0,0 +1,38 @@
+package strategy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Friction is the cost of executing a single leg (e.g. time spent whispering
+// and trading). Flat costs are in units of the starting item.
+type Friction struct {
+	Percent float64 `json:"percent,omitempty"`
+	Flat    float64 `json:"flat,omitempty"`
+}
+
+// ParseFriction parses a percentage (e.g. 0.5%) or a flat amount (e.g. 2)
+func ParseFriction(friction string) (Friction, error) {
+	friction = strings.TrimSpace(friction)
+	if friction == "" {
+		return Friction{}, nil
+	}
+
+	isPercent := strings.HasSuffix(friction, "%")
+	value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(friction, "%")), 64)
+	if err != nil {
+		return Friction{}, fmt.Errorf("invalid friction %q, expected a percentage (e.g. 0.5%%) or a flat amount", friction)
+	}
+	if value < 0 {
+		return Friction{}, fmt.Errorf("invalid friction %q, cannot be negative", friction)
+	}
+	if isPercent {
+		if value >= 100 {
+			return Friction{}, fmt.Errorf("invalid friction %q, must be below 100%%", friction)
+		}
+		return Friction{Percent: value}, nil
+	}
+	return Friction{Flat: value}, nil
+}
@@ -0,0 +1,86 @@
+package strategy
+
+import (
+	"testing"
+
+	"github.com/t73liu/poe-arbitrage/api"
+)
+
+func TestParseFriction(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Friction
+		wantErr bool
+	}{
+		{"", Friction{}, false},
+		{"0.5%", Friction{Percent: 0.5}, false},
+		{" 1.5 % ", Friction{Percent: 1.5}, false},
+		{"2", Friction{Flat: 2}, false},
+		{"0", Friction{}, false},
+		{"-1", Friction{}, true},
+		{"-1%", Friction{}, true},
+		{"100%", Friction{}, true},
+		{"abc", Friction{}, true},
+		{"%", Friction{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseFriction(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFriction(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFriction(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// 100 chaos buy 10 exalted that sell for 120 chaos, 20% before friction
+func TestEvaluateTradePathFriction(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    Options
+		wantOK     bool
+		wantGain   float64
+		wantProfit float64
+	}{
+		{"no friction", Options{MinGainPercent: 1}, true, 20, 20},
+		// 100 * 0.95 * 1.2 * 0.95 = 108.3
+		{"percent friction", Options{MinGainPercent: 1, LegFriction: Friction{Percent: 5}}, true, 8.3, 8.3},
+		{
+			"percent friction below min gain percent",
+			Options{MinGainPercent: 10, LegFriction: Friction{Percent: 5}},
+			false, 0, 0,
+		},
+		// 2 chaos per leg
+		{"flat friction", Options{MinGainPercent: 1, LegFriction: Friction{Flat: 2}}, true, 16, 16},
+		{"flat friction exceeding the gains", Options{LegFriction: Friction{Flat: 11}}, false, 0, 0},
+		{"min gain reached", Options{MinGain: 20}, true, 20, 20},
+		{"flat friction below min gain", Options{MinGain: 17, LegFriction: Friction{Flat: 2}}, false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp := newTestPaths(
+				t,
+				map[string]int{"chaos": 100},
+				tt.options,
+				book{"chaos", "exalted", []api.TradeDetail{listing("a", 10, 1, 100)}},
+				book{"exalted", "chaos", []api.TradeDetail{listing("b", 1, 12, 1000)}},
+			)
+			opportunity, ok := tp.evaluateTradePath([]TradingPair{{"chaos", "exalted"}, {"exalted", "chaos"}})
+			if ok != tt.wantOK {
+				t.Fatalf("evaluateTradePath() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if !almostEqual(opportunity.GainPercent, tt.wantGain) {
+				t.Errorf("GainPercent = %f, want %f", opportunity.GainPercent, tt.wantGain)
+			}
+			if !almostEqual(opportunity.Profit, tt.wantProfit) {
+				t.Errorf("Profit = %f, want %f", opportunity.Profit, tt.wantProfit)
+			}
+		})
+	}
+}
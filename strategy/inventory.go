@@ -0,0 +1,44 @@
+package strategy
+
+import (
+	"github.com/t73liu/poe-arbitrage/api"
+	"github.com/t73liu/poe-arbitrage/utils"
+)
+
+// inventoryCapacity returns the max amount of item that fits in the inventory,
+// 0 if the inventory or the stack size of item is unknown
+func (tp *TradingPaths) inventoryCapacity(item string) uint {
+	if tp.options.InventorySlots <= 0 {
+		return 0
+	}
+	return uint(tp.options.InventorySlots) * tp.options.StackSizes[item]
+}
+
+// tradeRounds splits payAmount paid to the seller of trade into the amounts
+// paid in every trade window when neither side of a single window may exceed
+// the inventory. Returns false if a single lot of the listing does not fit.
+func (tp *TradingPaths) tradeRounds(pair TradingPair, trade api.TradeDetail, payAmount uint) ([]uint, bool) {
+	gcd := utils.CalcGCD(trade.PriceAmount, trade.ItemAmount)
+	minPrice := trade.PriceAmount / gcd
+	minItem := trade.ItemAmount / gcd
+
+	lots := payAmount / minPrice
+	lotsPerRound := lots
+	if capacity := tp.inventoryCapacity(pair.InitialItem); capacity > 0 {
+		lotsPerRound = utils.CalcMin(lotsPerRound, capacity/minPrice)
+	}
+	if capacity := tp.inventoryCapacity(pair.TargetItem); capacity > 0 {
+		lotsPerRound = utils.CalcMin(lotsPerRound, capacity/minItem)
+	}
+	if lotsPerRound == 0 {
+		return nil, false
+	}
+
+	rounds := make([]uint, 0, (lots+lotsPerRound-1)/lotsPerRound)
+	for remainingLots := lots; remainingLots > 0; {
+		roundLots := utils.CalcMin(remainingLots, lotsPerRound)
+		rounds = append(rounds, roundLots*minPrice)
+		remainingLots -= roundLots
+	}
+	return rounds, true
+}
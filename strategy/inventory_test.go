@@ -0,0 +1,63 @@
+package strategy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/t73liu/poe-arbitrage/api"
+)
+
+func TestTradeRounds(t *testing.T) {
+	pair := TradingPair{InitialItem: "chaos", TargetItem: "exalted"}
+	stackSizes := map[string]uint{"chaos": 10, "exalted": 10}
+
+	tests := []struct {
+		name      string
+		slots     int
+		trade     api.TradeDetail
+		payAmount uint
+		want      []uint
+		wantOK    bool
+	}{
+		{"unlimited inventory", 0, listing("a", 150, 1, 100), 1500, []uint{1500}, true},
+		{"fits a single round", 60, listing("a", 150, 1, 100), 600, []uint{600}, true},
+		// 60 slots hold 600 chaos, i.e. 4 lots of 150 chaos
+		{"split by paid item", 60, listing("a", 150, 1, 100), 1500, []uint{600, 600, 300}, true},
+		// 2 slots hold 20 exalted, i.e. 2 lots of 10 exalted
+		{"split by received item", 2, listing("a", 1, 10, 100), 5, []uint{2, 2, 1}, true},
+		{"lot larger than the inventory", 2, listing("a", 150, 1, 100), 150, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp := NewTradingPaths(nil, Options{InventorySlots: tt.slots, StackSizes: stackSizes})
+			got, ok := tp.tradeRounds(pair, tt.trade, tt.payAmount)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tradeRounds() = (%v, %v), want (%v, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFillLegWhispersPerRound(t *testing.T) {
+	tp := newTestPaths(
+		t,
+		map[string]int{"chaos": 1500},
+		Options{InventorySlots: 60, StackSizes: map[string]uint{"chaos": 10, "exalted": 10}},
+		book{"chaos", "exalted", []api.TradeDetail{listing("a", 150, 1, 100)}},
+	)
+	leg, ok := tp.fillLeg(TradingPair{InitialItem: "chaos", TargetItem: "exalted"}, 1500, nil)
+	if !ok {
+		t.Fatal("fillLeg() failed")
+	}
+	want := []string{
+		"@a buy 4 for 600",
+		"@a buy 4 for 600",
+		"@a buy 2 for 300",
+	}
+	if fill := leg.Fills[0]; !reflect.DeepEqual(fill.Whispers, want) || fill.Rounds != 3 {
+		t.Errorf("Whispers = %v (%d rounds), want %v", fill.Whispers, fill.Rounds, want)
+	}
+	if leg.Rounds != 3 {
+		t.Errorf("Rounds = %d, want 3", leg.Rounds)
+	}
+}
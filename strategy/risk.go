@@ -0,0 +1,74 @@
+package strategy
+
+import (
+	"math"
+
+	"github.com/t73liu/poe-arbitrage/utils"
+)
+
+// Estimated probability that a seller completes a whisper
+const (
+	baseFillProbability     = 0.9
+	afkFillProbability      = 0.5
+	favoriteFillProbability = 0.98
+)
+
+// Requesting more than this share of a listing's stock fails if the seller
+// trades with someone else first
+const highStockUsage = 0.8
+const highStockUsagePenalty = 0.85
+
+// Listings priced better than the median of the pair by more than this are
+// likely stale or mistakes
+const medianDeviationThreshold = 0.05
+const minDeviationProbability = 0.5
+
+// scoreRisk estimates the probability that every fill of opportunity
+// completes. Every additional fill (and therefore leg) compounds the risk.
+func (tp *TradingPaths) scoreRisk(opportunity *Opportunity) {
+	successProbability := 1.0
+	for i := range opportunity.Legs {
+		leg := &opportunity.Legs[i]
+		medianRatio := tp.medianRatio(leg.Pair)
+		for j := range leg.Fills {
+			fill := &leg.Fills[j]
+			fill.FillProbability = tp.fillProbability(*fill, medianRatio)
+			successProbability *= fill.FillProbability
+		}
+	}
+	opportunity.Risk = 1 - successProbability
+	opportunity.RiskAdjustedGain = opportunity.GainPercent * successProbability
+}
+
+func (tp *TradingPaths) fillProbability(fill Fill, medianRatio float64) float64 {
+	listing := fill.Listing
+	probability := baseFillProbability
+	if utils.Contains(tp.options.FavoritePlayers, listing.Account) {
+		probability = favoriteFillProbability
+	}
+	if listing.AFK {
+		probability = math.Min(probability, afkFillProbability)
+	}
+
+	if listing.Stock > 0 && float64(fill.ReceiveAmount)/float64(listing.Stock) > highStockUsage {
+		probability *= highStockUsagePenalty
+	}
+
+	if medianRatio > 0 {
+		deviation := listing.Ratio/medianRatio - 1
+		if deviation > medianDeviationThreshold {
+			probability *= math.Max(minDeviationProbability, 1-(deviation-medianDeviationThreshold))
+		}
+	}
+	return probability
+}
+
+// medianRatio returns the median ratio of the listings of pair
+func (tp *TradingPaths) medianRatio(pair TradingPair) float64 {
+	trades := tp.tradingPairTrades[pair]
+	ratios := make([]float64, 0, len(trades))
+	for _, trade := range trades {
+		ratios = append(ratios, trade.Ratio)
+	}
+	return utils.CalcMedian(ratios)
+}
@@ -0,0 +1,70 @@
+package strategy
+
+import (
+	"testing"
+
+	"github.com/t73liu/poe-arbitrage/api"
+)
+
+func TestFillProbability(t *testing.T) {
+	tests := []struct {
+		name        string
+		listing     api.TradeDetail
+		receive     uint
+		medianRatio float64
+		want        float64
+	}{
+		{"base", api.TradeDetail{Account: "a", Ratio: 0.1, Stock: 100}, 10, 0.1, 0.9},
+		{"favorite", api.TradeDetail{Account: "friend", Ratio: 0.1, Stock: 100}, 10, 0.1, 0.98},
+		{"afk", api.TradeDetail{Account: "a", AFK: true, Ratio: 0.1, Stock: 100}, 10, 0.1, 0.5},
+		{"afk favorite", api.TradeDetail{Account: "friend", AFK: true, Ratio: 0.1, Stock: 100}, 10, 0.1, 0.5},
+		{"high stock usage", api.TradeDetail{Account: "a", Ratio: 0.1, Stock: 100}, 90, 0.1, 0.9 * 0.85},
+		{"within median threshold", api.TradeDetail{Account: "a", Ratio: 0.104, Stock: 100}, 10, 0.1, 0.9},
+		{"above median", api.TradeDetail{Account: "a", Ratio: 0.115, Stock: 100}, 10, 0.1, 0.9 * 0.9},
+		{"far above median", api.TradeDetail{Account: "a", Ratio: 0.2, Stock: 100}, 10, 0.1, 0.9 * 0.5},
+		{"below median", api.TradeDetail{Account: "a", Ratio: 0.05, Stock: 100}, 10, 0.1, 0.9},
+		{"no median", api.TradeDetail{Account: "a", Ratio: 0.2, Stock: 100}, 10, 0, 0.9},
+	}
+	tp := NewTradingPaths(nil, Options{FavoritePlayers: []string{"friend"}})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fill := Fill{Listing: tt.listing, ReceiveAmount: tt.receive}
+			if got := tp.fillProbability(fill, tt.medianRatio); !almostEqual(got, tt.want) {
+				t.Errorf("fillProbability() = %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreRisk(t *testing.T) {
+	tp := newTestPaths(
+		t,
+		map[string]int{"chaos": 100},
+		Options{MinGainPercent: 1},
+		book{"chaos", "exalted", []api.TradeDetail{listing("a", 10, 1, 100)}},
+		// The median of 11 makes the best listing slightly suspicious
+		book{"exalted", "chaos", []api.TradeDetail{listing("b", 1, 12, 1000), listing("c", 1, 10, 1000)}},
+	)
+	opportunity, ok := tp.evaluateTradePath([]TradingPair{{"chaos", "exalted"}, {"exalted", "chaos"}})
+	if !ok {
+		t.Fatal("path is not profitable")
+	}
+
+	wantProbabilities := []float64{0.9, 0.9 * (1 - (12.0/11 - 1 - 0.05))}
+	success := 1.0
+	for i, leg := range opportunity.Legs {
+		if len(leg.Fills) != 1 {
+			t.Fatalf("leg %d has %d fills, want 1", i, len(leg.Fills))
+		}
+		if got := leg.Fills[0].FillProbability; !almostEqual(got, wantProbabilities[i]) {
+			t.Errorf("leg %d FillProbability = %f, want %f", i, got, wantProbabilities[i])
+		}
+		success *= wantProbabilities[i]
+	}
+	if !almostEqual(opportunity.Risk, 1-success) {
+		t.Errorf("Risk = %f, want %f", opportunity.Risk, 1-success)
+	}
+	if !almostEqual(opportunity.RiskAdjustedGain, opportunity.GainPercent*success) {
+		t.Errorf("RiskAdjustedGain = %f, want %f", opportunity.RiskAdjustedGain, opportunity.GainPercent*success)
+	}
+}
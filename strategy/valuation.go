@@ -0,0 +1,95 @@
+package strategy
+
+import (
+	"sort"
+
+	"github.com/t73liu/poe-arbitrage/utils"
+)
+
+// Valuations returns the mid-market value of every item in units of reference.
+// Items without a book against reference are valued through the closest item
+// that has one (e.g. gcp => exalted => chaos). Items that cannot be reached
+// from reference are omitted.
+func (tp *TradingPaths) Valuations(reference string) map[string]float64 {
+	items := tp.items()
+	valuations := make(map[string]float64, len(items))
+	if !utils.Contains(items, reference) {
+		return valuations
+	}
+	valuations[reference] = 1
+
+	// Breadth-first so that every item is valued through the fewest books
+	queue := []string{reference}
+	for len(queue) > 0 {
+		valuedItem := queue[0]
+		queue = queue[1:]
+		for _, item := range items {
+			if _, ok := valuations[item]; ok {
+				continue
+			}
+			if midPrice, ok := tp.midPrice(item, valuedItem); ok {
+				valuations[item] = midPrice * valuations[valuedItem]
+				queue = append(queue, item)
+			}
+		}
+	}
+	return valuations
+}
+
+// midPrice returns the value of 1 item in units of quoteItem, averaging the
+// best bid and ask if both sides have listings
+func (tp *TradingPaths) midPrice(item, quoteItem string) (float64, bool) {
+	// Selling item receives quoteItem at the listed ratio
+	bid := tp.bestRatio(item, quoteItem)
+	// Buying item costs 1/ratio of quoteItem
+	ask := 0.0
+	if buyRatio := tp.bestRatio(quoteItem, item); buyRatio > 0 {
+		ask = 1 / buyRatio
+	}
+
+	switch {
+	case bid > 0 && ask > 0:
+		return (bid + ask) / 2, true
+	case bid > 0:
+		return bid, true
+	case ask > 0:
+		return ask, true
+	default:
+		return 0, false
+	}
+}
+
+// Returns every item with listings in either direction sorted by name
+func (tp *TradingPaths) items() []string {
+	itemSet := make(map[string]bool)
+	for pair := range tp.tradingPairTrades {
+		itemSet[pair.InitialItem] = true
+		itemSet[pair.TargetItem] = true
+	}
+	items := make([]string, 0, len(itemSet))
+	for item := range itemSet {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	return items
+}
+
+// valueOpportunities sets the reference values of opportunities whose start
+// item can be valued
+func (tp *TradingPaths) valueOpportunities(opportunities []Opportunity) {
+	reference := tp.options.ReferenceCurrency
+	valuations := tp.Valuations(reference)
+	for i := range opportunities {
+		setValue(&opportunities[i], reference, valuations)
+	}
+}
+
+func setValue(opportunity *Opportunity, reference string, valuations map[string]float64) {
+	value, ok := valuations[opportunity.StartItem]
+	if !ok {
+		return
+	}
+	opportunity.ReferenceCurrency = reference
+	opportunity.ProfitValue = opportunity.Profit * value
+	opportunity.CapitalValue = float64(opportunity.Legs[0].PayAmount) * value
+}
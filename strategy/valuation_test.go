@@ -0,0 +1,44 @@
+package strategy
+
+import (
+	"testing"
+
+	"github.com/t73liu/poe-arbitrage/api"
+)
+
+func TestValuations(t *testing.T) {
+	tp := newTestPaths(
+		t,
+		nil,
+		Options{},
+		// Both sides: sells for 150 chaos, buys for 160 chaos
+		book{"exalted", "chaos", []api.TradeDetail{listing("ec", 1, 150, 10)}},
+		book{"chaos", "exalted", []api.TradeDetail{listing("ce", 160, 1, 10)}},
+		// Only chaos buys gcp at 2 gcp per chaos
+		book{"chaos", "gcp", []api.TradeDetail{listing("cg", 1, 2, 100)}},
+		// Only valued through exalted
+		book{"divine", "exalted", []api.TradeDetail{listing("de", 1, 2, 10)}},
+		// Not connected to chaos
+		book{"alch", "fusing", []api.TradeDetail{listing("af", 1, 1, 10)}},
+	)
+
+	valuations := tp.Valuations("chaos")
+	want := map[string]float64{
+		"chaos":   1,
+		"exalted": 155,
+		"gcp":     0.5,
+		"divine":  310,
+	}
+	if len(valuations) != len(want) {
+		t.Errorf("Valuations() = %v, want %v", valuations, want)
+	}
+	for item, value := range want {
+		if got, ok := valuations[item]; !ok || !almostEqual(got, value) {
+			t.Errorf("Valuations()[%s] = %f, want %f", item, got, value)
+		}
+	}
+
+	if valuations := tp.Valuations("mirror"); len(valuations) != 0 {
+		t.Errorf("Valuations(mirror) = %v, want none", valuations)
+	}
+}
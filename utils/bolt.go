@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// OpenBolt opens the bbolt database at path, waiting up to a second for
+// another process to release it. Any number of read-only processes can hold
+// the database as long as no writer does.
+func OpenBolt(path string, readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: readOnly})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s is in use by another process", path)
+	}
+	return db, err
+}
+
+// TimeKey is the big-endian timestamp prefixing keys so that they are ordered
+// by time
+func TimeKey(t time.Time) []byte {
+	key := make([]byte, 8, 16)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// KeyTime returns the timestamp prefixing a key created with TimeKey
+func KeyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key[:8])))
+}
+
+// ForEachInRange calls fn in order with the values of bucket whose keys are
+// prefixed with a time within [from, to]. A zero from starts at the first key.
+func ForEachInRange(bucket *bolt.Bucket, from, to time.Time, fn func(value []byte) error) error {
+	cursor := bucket.Cursor()
+	key, value := cursor.First()
+	if !from.IsZero() {
+		key, value = cursor.Seek(TimeKey(from))
+	}
+	for ; key != nil; key, value = cursor.Next() {
+		if KeyTime(key).After(to) {
+			break
+		}
+		if err := fn(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestForEachInRange(t *testing.T) {
+	db, err := OpenBolt(filepath.Join(t.TempDir(), "test.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	start := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	bucketName := []byte("test")
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		for hour := 0; hour < 4; hour++ {
+			key := append(TimeKey(start.Add(time.Duration(hour)*time.Hour)), 'x')
+			if err := bucket.Put(key, []byte{byte('a' + hour)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     string
+	}{
+		{"everything", time.Time{}, start.Add(24 * time.Hour), "abcd"},
+		{"inclusive bounds", start.Add(time.Hour), start.Add(2 * time.Hour), "bc"},
+		{"before the first key", time.Time{}, start.Add(-time.Hour), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []byte
+			err := db.View(func(tx *bolt.Tx) error {
+				return ForEachInRange(tx.Bucket(bucketName), tt.from, tt.to, func(value []byte) error {
+					got = append(got, value...)
+					return nil
+				})
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ForEachInRange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if key := TimeKey(start); !KeyTime(key).Equal(start) {
+		t.Errorf("KeyTime(TimeKey(%s)) = %s", start, KeyTime(key))
+	}
+}
@@ -1,5 +1,7 @@
 package utils
 
+import "sort"
+
 // CalcGCD calculates greatest common divisor using Euclidean Algorithm
 func CalcGCD(a, b uint) uint {
 	for b != 0 {
@@ -16,3 +18,16 @@ func CalcMin(a, b uint) uint {
 	}
 	return b
 }
+
+// CalcMedian returns the median of values, values are sorted in place
+func CalcMedian(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	middle := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[middle-1] + values[middle]) / 2
+	}
+	return values[middle]
+}